@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/rowanjacobs/ova-provider-spike/internal/helper"
+	"github.com/vmware/govmomi/ovf"
+)
+
+func dataSourceDescriptor() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceDescriptorRead,
+
+		Schema: map[string]*schema.Schema{
+			"path": {
+				Type:        schema.TypeString,
+				Required:    true,
+				Description: "The path or http(s) URL of an OVF descriptor, or of an OVA package containing one.",
+			},
+			"checksum": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The expected digest of the file at path, as sha256:<hex>, sha512:<hex> or sha1:<hex>. For an OVA this reads the whole package.",
+				ValidateFunc: validateChecksum,
+			},
+			"name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The name of the virtual system the OVF describes.",
+			},
+			"annotation": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The annotation of the OVF.",
+			},
+			"networks": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The networks the OVF expects to be mapped.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"name":        {Type: schema.TypeString, Computed: true},
+						"description": {Type: schema.TypeString, Computed: true},
+					},
+				},
+			},
+			"disks": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The virtual disks declared in the OVF's DiskSection.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id":       {Type: schema.TypeString, Computed: true},
+						"file":     {Type: schema.TypeString, Computed: true},
+						"capacity": {Type: schema.TypeInt, Computed: true, Description: "The capacity in bytes, or 0 if it depends on a property."},
+						"format":   {Type: schema.TypeString, Computed: true},
+					},
+				},
+			},
+			"properties": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The ProductSection properties, by ID as used in ova_template's properties.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id":                {Type: schema.TypeString, Computed: true},
+						"type":              {Type: schema.TypeString, Computed: true},
+						"default":           {Type: schema.TypeString, Computed: true},
+						"label":             {Type: schema.TypeString, Computed: true},
+						"description":       {Type: schema.TypeString, Computed: true},
+						"qualifiers":        {Type: schema.TypeString, Computed: true},
+						"user_configurable": {Type: schema.TypeBool, Computed: true},
+						"password":          {Type: schema.TypeBool, Computed: true},
+					},
+				},
+			},
+			"deployment_options": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The configurations declared in the OVF's DeploymentOptionSection.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id":          {Type: schema.TypeString, Computed: true},
+						"label":       {Type: schema.TypeString, Computed: true},
+						"description": {Type: schema.TypeString, Computed: true},
+					},
+				},
+			},
+			"default_deployment_option": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The configuration used when none is requested.",
+			},
+			"os_type": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The vSphere guest ID the OVF declares, such as ubuntu64Guest.",
+			},
+			"os_description": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"virtual_hardware": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "A summary of each VirtualHardwareSection, for the default deployment option.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"version":   {Type: schema.TypeString, Computed: true},
+						"num_cpus":  {Type: schema.TypeInt, Computed: true},
+						"memory_mb": {Type: schema.TypeInt, Computed: true},
+					},
+				},
+			},
+			"eulas": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The text of every license agreement in the OVF.",
+				Elem:        &schema.Schema{Type: schema.TypeString},
+			},
+		},
+	}
+}
+
+// dataSourceDescriptorRead only reads the package and never asks the provider
+// for a vSphere client, so it works without vSphere credentials.
+func dataSourceDescriptorRead(d *schema.ResourceData, m interface{}) error {
+	var checksum *helper.Checksum
+	if v, ok := d.GetOk("checksum"); ok {
+		var err error
+		if checksum, err = helper.ParseChecksum(v.(string)); err != nil {
+			return err
+		}
+	}
+
+	// Verifying the checksum of a remote OVA downloads all of it, so there
+	// is no deadline on the read.
+	ctx := context.Background()
+	pkg, err := helper.OpenPackage(ctx, d.Get("path").(string), checksum)
+	if err != nil {
+		return err
+	}
+	if err := pkg.VerifyChecksum(ctx); err != nil {
+		return err
+	}
+	envelope := pkg.Envelope
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256(pkg.Descriptor)))
+
+	if envelope.VirtualSystem != nil {
+		name := envelope.VirtualSystem.ID
+		if envelope.VirtualSystem.Name != nil {
+			name = *envelope.VirtualSystem.Name
+		}
+		d.Set("name", name)
+	}
+
+	if envelope.Annotation != nil {
+		d.Set("annotation", envelope.Annotation.Annotation)
+	} else if envelope.VirtualSystem != nil && len(envelope.VirtualSystem.Annotation) > 0 {
+		d.Set("annotation", envelope.VirtualSystem.Annotation[0].Annotation)
+	}
+
+	var networks []map[string]interface{}
+	if envelope.Network != nil {
+		for _, n := range envelope.Network.Networks {
+			networks = append(networks, map[string]interface{}{
+				"name":        n.Name,
+				"description": n.Description,
+			})
+		}
+	}
+	if err := d.Set("networks", networks); err != nil {
+		return err
+	}
+
+	if err := d.Set("disks", flattenDescriptorDisks(envelope)); err != nil {
+		return err
+	}
+
+	if err := d.Set("properties", flattenDescriptorProperties(envelope)); err != nil {
+		return err
+	}
+
+	var options []map[string]interface{}
+	if envelope.DeploymentOption != nil {
+		for _, c := range envelope.DeploymentOption.Configuration {
+			options = append(options, map[string]interface{}{
+				"id":          c.ID,
+				"label":       c.Label,
+				"description": c.Description,
+			})
+		}
+	}
+	if err := d.Set("deployment_options", options); err != nil {
+		return err
+	}
+	d.Set("default_deployment_option", helper.DefaultDeploymentOption(envelope))
+
+	if os := helper.OperatingSystem(envelope); os != nil {
+		if os.OSType != nil {
+			d.Set("os_type", *os.OSType)
+		}
+		if os.Description != nil {
+			d.Set("os_description", *os.Description)
+		}
+	}
+
+	sections, err := helper.VirtualHardwareSections(envelope, "")
+	if err != nil {
+		return err
+	}
+	var hardware []map[string]interface{}
+	for _, h := range sections {
+		hardware = append(hardware, map[string]interface{}{
+			"version":   h.Version,
+			"num_cpus":  h.NumCPUs,
+			"memory_mb": int(h.MemoryMB),
+		})
+	}
+	if err := d.Set("virtual_hardware", hardware); err != nil {
+		return err
+	}
+
+	return d.Set("eulas", helper.EULAs(envelope))
+}
+
+func flattenDescriptorDisks(envelope *ovf.Envelope) []map[string]interface{} {
+	if envelope.Disk == nil {
+		return nil
+	}
+
+	files := map[string]string{}
+	for _, f := range envelope.References {
+		files[f.ID] = f.Href
+	}
+
+	var disks []map[string]interface{}
+	for _, disk := range envelope.Disk.Disks {
+		capacity, err := helper.DiskCapacity(disk)
+		if err != nil {
+			// Property driven capacities aren't known until deployment.
+			capacity = 0
+		}
+
+		var file, format string
+		if disk.FileRef != nil {
+			file = files[*disk.FileRef]
+		}
+		if disk.Format != nil {
+			format = *disk.Format
+		}
+
+		disks = append(disks, map[string]interface{}{
+			"id":       disk.DiskID,
+			"file":     file,
+			"capacity": int(capacity),
+			"format":   format,
+		})
+	}
+	return disks
+}
+
+func flattenDescriptorProperties(envelope *ovf.Envelope) []map[string]interface{} {
+	declared := helper.ProductProperties(envelope)
+
+	var ids []string
+	for id := range declared {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var properties []map[string]interface{}
+	for _, id := range ids {
+		p := declared[id]
+		properties = append(properties, map[string]interface{}{
+			"id":                id,
+			"type":              p.Type,
+			"default":           stringValue(p.Default),
+			"label":             stringValue(p.Label),
+			"description":       stringValue(p.Description),
+			"qualifiers":        stringValue(p.Qualifiers),
+			"user_configurable": p.UserConfigurable != nil && *p.UserConfigurable,
+			"password":          p.Password != nil && *p.Password,
+		})
+	}
+	return properties
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
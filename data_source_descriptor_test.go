@@ -0,0 +1,51 @@
+package main_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	main "github.com/rowanjacobs/ova-provider-spike"
+)
+
+const testDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+    <Name>appliance</Name>
+  </VirtualSystem>
+</Envelope>`
+
+// TestDataSourceDescriptor_unconfiguredProvider reads a descriptor through a
+// provider that has no vSphere credentials at all.
+func TestDataSourceDescriptor_unconfiguredProvider(t *testing.T) {
+	defer testUnsetVSphereEnv()()
+
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "appliance.ovf")
+	if err := ioutil.WriteFile(p, []byte(testDescriptor), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	provider := testUnconfiguredProvider(t)
+
+	ds := provider.DataSourcesMap["ova_descriptor"]
+	d := schema.TestResourceDataRaw(t, ds.Schema, map[string]interface{}{"path": p})
+	if err := ds.Read(d, provider.Meta()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if name := d.Get("name").(string); name != "appliance" {
+		t.Fatalf("bad name: %q", name)
+	}
+
+	// Anything that does need vSphere says what's missing.
+	if _, err := provider.Meta().(*main.ProviderMeta).Client(); err == nil {
+		t.Fatalf("expected an error without credentials")
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"fmt"
+	"path"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/rowanjacobs/ova-provider-spike/internal/helper"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func dataSourceTemplate() *schema.Resource {
+	return &schema.Resource{
+		Read: dataSourceTemplateRead,
+
+		Schema: map[string]*schema.Schema{
+			"name": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Computed:      true,
+				Description:   "The name of the template. Looked up in folder if set, or anywhere in datacenter otherwise.",
+				ConflictsWith: []string{"uuid"},
+			},
+			"folder": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The absolute path of the folder holding the template.",
+				ConflictsWith: []string{"uuid"},
+			},
+			"datacenter": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The name of the template's datacenter.",
+				ConflictsWith: []string{"uuid"},
+			},
+			"uuid": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "The BIOS UUID of the template.",
+			},
+			"guest_id": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The guest ID of the template's operating system.",
+			},
+			"disks": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The template's virtual disks.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"label":            {Type: schema.TypeString, Computed: true},
+						"file":             {Type: schema.TypeString, Computed: true},
+						"capacity":         {Type: schema.TypeInt, Computed: true, Description: "The capacity in bytes."},
+						"thin_provisioned": {Type: schema.TypeBool, Computed: true},
+					},
+				},
+			},
+			"network_interfaces": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Description: "The template's network adapters.",
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"label":        {Type: schema.TypeString, Computed: true},
+						"adapter_type": {Type: schema.TypeString, Computed: true},
+						"network_id":   {Type: schema.TypeString, Computed: true},
+					},
+				},
+			},
+			"source_checksum": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The checksum of the package the template was imported from, if ova_template was given one.",
+			},
+			"source_descriptor_digest": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The sha256 digest of the OVF descriptor the template was imported from, as sha256:<hex>.",
+			},
+			"product_name": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The product name from the OVF's ProductSection.",
+			},
+			"product_vendor": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"product_version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"product_full_version": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceTemplateRead(d *schema.ResourceData, m interface{}) error {
+	client, err := m.(*ProviderMeta).Client()
+	if err != nil {
+		return err
+	}
+
+	vm, err := dataSourceTemplateFind(client, d)
+	if err != nil {
+		return fmt.Errorf("Find template: %s", err)
+	}
+
+	props, err := helper.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("Get template properties: %s", err)
+	}
+	if props.Config == nil {
+		return fmt.Errorf("template %q has no configuration", vm.InventoryPath)
+	}
+	// A virtual machine that happens to share the name is not a template,
+	// and cloning it would copy whatever state it is running in.
+	if !props.Config.Template {
+		return fmt.Errorf("%q is a virtual machine, not a template", vm.InventoryPath)
+	}
+
+	d.SetId(vm.Reference().Value)
+	d.Set("name", props.Name)
+	d.Set("uuid", props.Config.Uuid)
+	d.Set("guest_id", props.Config.GuestId)
+	d.Set("source_checksum", helper.ExtraConfigValue(props, helper.SourceChecksumKey))
+	d.Set("source_descriptor_digest", helper.ExtraConfigValue(props, helper.SourceDescriptorKey))
+
+	if err := d.Set("disks", flattenTemplateDisks(props)); err != nil {
+		return err
+	}
+	if err := d.Set("network_interfaces", flattenTemplateNetworkInterfaces(props)); err != nil {
+		return err
+	}
+
+	if props.Config.VAppConfig != nil {
+		if products := props.Config.VAppConfig.GetVmConfigInfo().Product; len(products) > 0 {
+			d.Set("product_name", products[0].Name)
+			d.Set("product_vendor", products[0].Vendor)
+			d.Set("product_version", products[0].Version)
+			d.Set("product_full_version", products[0].FullVersion)
+		}
+	}
+
+	return nil
+}
+
+// dataSourceTemplateFind looks the template up by UUID, by its path in a
+// folder, or by name in a datacenter.
+func dataSourceTemplateFind(client *govmomi.Client, d *schema.ResourceData) (*object.VirtualMachine, error) {
+	if uuid := d.Get("uuid").(string); uuid != "" {
+		return helper.FromUUID(client, uuid)
+	}
+
+	name := d.Get("name").(string)
+	if name == "" {
+		return nil, fmt.Errorf("one of uuid or name must be set")
+	}
+
+	if folder := d.Get("folder").(string); folder != "" {
+		return helper.FromPath(client, path.Join(folder, name))
+	}
+
+	dcPath := d.Get("datacenter").(string)
+	if dcPath == "" {
+		return nil, fmt.Errorf("one of folder or datacenter must be set to look up a template by name")
+	}
+	dc, err := helper.Datacenter(client, dcPath)
+	if err != nil {
+		return nil, err
+	}
+	return helper.FromName(client, dc, name)
+}
+
+func flattenTemplateDisks(props *mo.VirtualMachine) []map[string]interface{} {
+	devices := object.VirtualDeviceList(props.Config.Hardware.Device)
+
+	var disks []map[string]interface{}
+	for _, device := range devices.SelectByType((*types.VirtualDisk)(nil)) {
+		disk := device.(*types.VirtualDisk)
+
+		capacity := disk.CapacityInBytes
+		if capacity == 0 {
+			capacity = disk.CapacityInKB * 1024
+		}
+
+		var file string
+		var thin bool
+		if backing, ok := disk.Backing.(*types.VirtualDiskFlatVer2BackingInfo); ok {
+			file = backing.FileName
+			thin = backing.ThinProvisioned != nil && *backing.ThinProvisioned
+		}
+
+		disks = append(disks, map[string]interface{}{
+			"label":            deviceLabel(disk),
+			"file":             file,
+			"capacity":         int(capacity),
+			"thin_provisioned": thin,
+		})
+	}
+	return disks
+}
+
+func flattenTemplateNetworkInterfaces(props *mo.VirtualMachine) []map[string]interface{} {
+	devices := object.VirtualDeviceList(props.Config.Hardware.Device)
+
+	var nics []map[string]interface{}
+	for _, device := range devices.SelectByType((*types.VirtualEthernetCard)(nil)) {
+		card := device.(types.BaseVirtualEthernetCard).GetVirtualEthernetCard()
+
+		var networkID string
+		switch backing := card.Backing.(type) {
+		case *types.VirtualEthernetCardNetworkBackingInfo:
+			if backing.Network != nil {
+				networkID = backing.Network.Value
+			}
+		case *types.VirtualEthernetCardDistributedVirtualPortBackingInfo:
+			networkID = backing.Port.PortgroupKey
+		case *types.VirtualEthernetCardOpaqueNetworkBackingInfo:
+			networkID = backing.OpaqueNetworkId
+		}
+
+		nics = append(nics, map[string]interface{}{
+			"label":        deviceLabel(device),
+			"adapter_type": networkInterfaceAdapterType(device),
+			"network_id":   networkID,
+		})
+	}
+	return nics
+}
+
+// networkInterfaceAdapterType returns the kind of virtual network adapter a
+// card is, such as "vmxnet3". VirtualDeviceList.Type calls all of them
+// "ethernet".
+func networkInterfaceAdapterType(device types.BaseVirtualDevice) string {
+	switch device.(type) {
+	case *types.VirtualE1000:
+		return "e1000"
+	case *types.VirtualE1000e:
+		return "e1000e"
+	case *types.VirtualPCNet32:
+		return "pcnet32"
+	case *types.VirtualSriovEthernetCard:
+		return "sriov"
+	case *types.VirtualVmxnet2:
+		return "vmxnet2"
+	case *types.VirtualVmxnet3:
+		return "vmxnet3"
+	case *types.VirtualVmxnet3Vrdma:
+		return "vmxnet3vrdma"
+	}
+	return "unknown"
+}
+
+// deviceLabel returns the label vSphere shows for a device, such as "Hard
+// disk 1".
+func deviceLabel(device types.BaseVirtualDevice) string {
+	if info := device.GetVirtualDevice().DeviceInfo; info != nil {
+		return info.GetDescription().Label
+	}
+	return ""
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func testTemplateProperties(devices ...types.BaseVirtualDevice) *mo.VirtualMachine {
+	return &mo.VirtualMachine{
+		Config: &types.VirtualMachineConfigInfo{
+			Hardware: types.VirtualHardware{Device: devices},
+		},
+	}
+}
+
+func testDeviceInfo(label string) *types.Description {
+	return &types.Description{Label: label}
+}
+
+func TestFlattenTemplateDisks(t *testing.T) {
+	thin := true
+	cases := []struct {
+		name     string
+		disk     *types.VirtualDisk
+		expected map[string]interface{}
+	}{
+		{
+			name: "flat",
+			disk: &types.VirtualDisk{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Hard disk 1"),
+					Backing: &types.VirtualDiskFlatVer2BackingInfo{
+						VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{FileName: "[datastore1] appliance/appliance.vmdk"},
+						ThinProvisioned:              &thin,
+					},
+				},
+				CapacityInBytes: 2 * 1024 * 1024 * 1024,
+				CapacityInKB:    1,
+			},
+			expected: map[string]interface{}{
+				"label":            "Hard disk 1",
+				"file":             "[datastore1] appliance/appliance.vmdk",
+				"capacity":         2 * 1024 * 1024 * 1024,
+				"thin_provisioned": true,
+			},
+		},
+		{
+			name: "capacity in KB",
+			disk: &types.VirtualDisk{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Hard disk 2"),
+					Backing: &types.VirtualDiskFlatVer2BackingInfo{
+						VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{FileName: "[datastore1] appliance/appliance_1.vmdk"},
+					},
+				},
+				CapacityInKB: 1024,
+			},
+			expected: map[string]interface{}{
+				"label":            "Hard disk 2",
+				"file":             "[datastore1] appliance/appliance_1.vmdk",
+				"capacity":         1024 * 1024,
+				"thin_provisioned": false,
+			},
+		},
+		{
+			name: "other backing",
+			disk: &types.VirtualDisk{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Hard disk 3"),
+					Backing: &types.VirtualDiskRawDiskMappingVer1BackingInfo{
+						VirtualDeviceFileBackingInfo: types.VirtualDeviceFileBackingInfo{FileName: "[datastore1] appliance/rdm.vmdk"},
+					},
+				},
+				CapacityInBytes: 4096,
+			},
+			expected: map[string]interface{}{
+				"label":            "Hard disk 3",
+				"file":             "",
+				"capacity":         4096,
+				"thin_provisioned": false,
+			},
+		},
+		{
+			name: "no device info",
+			disk: &types.VirtualDisk{CapacityInBytes: 4096},
+			expected: map[string]interface{}{
+				"label":            "",
+				"file":             "",
+				"capacity":         4096,
+				"thin_provisioned": false,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			props := testTemplateProperties(tc.disk, &types.VirtualVmxnet3{})
+			expected := []map[string]interface{}{tc.expected}
+			if actual := flattenTemplateDisks(props); !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("expected %#v, got %#v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestFlattenTemplateNetworkInterfaces(t *testing.T) {
+	cases := []struct {
+		name     string
+		card     types.BaseVirtualDevice
+		expected map[string]interface{}
+	}{
+		{
+			name: "standard network",
+			card: &types.VirtualVmxnet3{VirtualVmxnet: types.VirtualVmxnet{VirtualEthernetCard: types.VirtualEthernetCard{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Network adapter 1"),
+					Backing: &types.VirtualEthernetCardNetworkBackingInfo{
+						Network: &types.ManagedObjectReference{Type: "Network", Value: "network-1"},
+					},
+				},
+			}}},
+			expected: map[string]interface{}{
+				"label":        "Network adapter 1",
+				"adapter_type": "vmxnet3",
+				"network_id":   "network-1",
+			},
+		},
+		{
+			name: "distributed port group",
+			card: &types.VirtualE1000{VirtualEthernetCard: types.VirtualEthernetCard{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Network adapter 2"),
+					Backing: &types.VirtualEthernetCardDistributedVirtualPortBackingInfo{
+						Port: types.DistributedVirtualSwitchPortConnection{
+							SwitchUuid:   "50 1e 3b 6e 0a 9f 3c 4f-9c 0e 53 6e 27 25 fd 8b",
+							PortgroupKey: "dvportgroup-1",
+						},
+					},
+				},
+			}},
+			expected: map[string]interface{}{
+				"label":        "Network adapter 2",
+				"adapter_type": "e1000",
+				"network_id":   "dvportgroup-1",
+			},
+		},
+		{
+			name: "opaque network",
+			card: &types.VirtualE1000e{VirtualEthernetCard: types.VirtualEthernetCard{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Network adapter 3"),
+					Backing: &types.VirtualEthernetCardOpaqueNetworkBackingInfo{
+						OpaqueNetworkId:   "5b4f1d10-8a0c-4f1e-9d1c-7c0e2f3a4b5c",
+						OpaqueNetworkType: "nsx.LogicalSwitch",
+					},
+				},
+			}},
+			expected: map[string]interface{}{
+				"label":        "Network adapter 3",
+				"adapter_type": "e1000e",
+				"network_id":   "5b4f1d10-8a0c-4f1e-9d1c-7c0e2f3a4b5c",
+			},
+		},
+		{
+			name: "not connected",
+			card: &types.VirtualPCNet32{VirtualEthernetCard: types.VirtualEthernetCard{
+				VirtualDevice: types.VirtualDevice{
+					DeviceInfo: testDeviceInfo("Network adapter 4"),
+					Backing:    &types.VirtualEthernetCardNetworkBackingInfo{},
+				},
+			}},
+			expected: map[string]interface{}{
+				"label":        "Network adapter 4",
+				"adapter_type": "pcnet32",
+				"network_id":   "",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			props := testTemplateProperties(&types.VirtualDisk{}, tc.card)
+			expected := []map[string]interface{}{tc.expected}
+			if actual := flattenTemplateNetworkInterfaces(props); !reflect.DeepEqual(actual, expected) {
+				t.Fatalf("expected %#v, got %#v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestDataSourceTemplateFind_arguments(t *testing.T) {
+	cases := []struct {
+		name     string
+		raw      map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "no uuid or name",
+			raw:      map[string]interface{}{},
+			expected: "one of uuid or name must be set",
+		},
+		{
+			name:     "name without folder or datacenter",
+			raw:      map[string]interface{}{"name": "appliance"},
+			expected: "one of folder or datacenter must be set to look up a template by name",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			d := schema.TestResourceDataRaw(t, dataSourceTemplate().Schema, tc.raw)
+			// Neither case gets as far as talking to vSphere.
+			_, err := dataSourceTemplateFind(nil, d)
+			if err == nil || err.Error() != tc.expected {
+				t.Fatalf("expected %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
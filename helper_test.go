@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/hashicorp/terraform/terraform"
+	main "github.com/rowanjacobs/ova-provider-spike"
 	"github.com/rowanjacobs/ova-provider-spike/internal/helper"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/object"
@@ -11,7 +12,10 @@ import (
 
 // testGetTemplate is a convenience method to fetch a template by resource name.
 func testGetTemplate(s *terraform.State, resourceName string) (*object.VirtualMachine, error) {
-	client := testGetClient()
+	client, err := testGetClient()
+	if err != nil {
+		return nil, err
+	}
 	attributes, err := testGetAttributesForResource(s, fmt.Sprintf("ova_template.%s", resourceName))
 	if err != nil {
 		return nil, err
@@ -23,8 +27,8 @@ func testGetTemplate(s *terraform.State, resourceName string) (*object.VirtualMa
 	return helper.FromUUID(client, uuid)
 }
 
-func testGetClient() *govmomi.Client {
-	return testAccProvider.Meta().(*govmomi.Client)
+func testGetClient() (*govmomi.Client, error) {
+	return testAccProvider.Meta().(*main.ProviderMeta).Client()
 }
 
 func testGetAttributesForResource(s *terraform.State, addr string) (map[string]string, error) {
@@ -0,0 +1,247 @@
+package helper
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+// adapted from govc importx archive handling
+
+// Archive provides access to the descriptor and the files it references,
+// regardless of whether they are packed in an OVA or sit next to an OVF,
+// locally or on a web server.
+type Archive interface {
+	// Open opens the file in the archive with the given name, returning a
+	// reader for its contents and its size. The size is -1 when it is not
+	// known up front. Names are compared literally, so characters like * and
+	// [ that are legal in file names have no special meaning. Cancelling ctx
+	// aborts a remote read.
+	Open(ctx context.Context, name string) (io.ReadCloser, int64, error)
+}
+
+// FileNotFoundError is returned when an archive has no file with the
+// requested name.
+type FileNotFoundError struct {
+	Name string
+}
+
+// Error implements error for FileNotFoundError.
+func (e *FileNotFoundError) Error() string {
+	return fmt.Sprintf("%s not found", e.Name)
+}
+
+// OpenArchive returns the Archive for the file or URL at path. When the
+// extension doesn't tell an OVA from an OVF, as with an artifact server URL
+// like .../download?id=123, the start of the file is read to find out.
+func OpenArchive(ctx context.Context, path string) (Archive, error) {
+	switch strings.ToLower(sourceExt(path)) {
+	case ".ova":
+		return &TapeArchive{Path: path}, nil
+	case ".ovf":
+		return &FileArchive{Path: path}, nil
+	}
+
+	tape, err := isTape(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if tape {
+		return &TapeArchive{Path: path}, nil
+	}
+	return &FileArchive{Path: path}, nil
+}
+
+// sourceExt returns the extension of the file or URL path at path.
+func sourceExt(path string) string {
+	if u, err := url.Parse(path); err == nil && IsRemote(path) {
+		path = u.Path
+	}
+	return filepath.Ext(path)
+}
+
+// isTape reports whether the file at path starts with a tar header, which
+// has the "ustar" magic at offset 257.
+func isTape(ctx context.Context, path string) (bool, error) {
+	f, _, err := openSource(ctx, path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	header := make([]byte, 512)
+	if _, err := io.ReadFull(f, header); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failure reading %s: %s", path, err)
+	}
+	return string(header[257:262]) == "ustar", nil
+}
+
+// ReadDescriptor reads the raw OVF descriptor out of an archive.
+func ReadDescriptor(ctx context.Context, archive Archive) ([]byte, error) {
+	r, _, err := openDescriptor(ctx, archive)
+	if err != nil {
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// ReadEnvelope reads the OVF descriptor of the OVF or OVA at path, returning
+// it both raw and parsed.
+func ReadEnvelope(ctx context.Context, path string) ([]byte, *ovf.Envelope, error) {
+	archive, err := OpenArchive(ctx, path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	descriptor, err := ReadDescriptor(ctx, archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	envelope, err := ovf.Unmarshal(bytes.NewReader(descriptor))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failure unmarshalling ovf: %s", err)
+	}
+	return descriptor, envelope, nil
+}
+
+// openDescriptor opens the .ovf file of an archive: the one at a
+// FileArchive's path, or the first one in an OVA.
+func openDescriptor(ctx context.Context, archive Archive) (io.ReadCloser, int64, error) {
+	switch a := archive.(type) {
+	case *TapeArchive:
+		return a.open(ctx, hasExtension(".ovf"), "*.ovf", -1)
+	case *FileArchive:
+		return openSource(ctx, a.Path)
+	}
+	return nil, 0, fmt.Errorf("unsupported archive %T", archive)
+}
+
+// hasExtension returns a matcher for file names ending in ext, ignoring
+// case.
+func hasExtension(ext string) func(string) bool {
+	return func(name string) bool {
+		return strings.EqualFold(path.Ext(name), ext)
+	}
+}
+
+// TapeArchive is an OVA package. Entries are streamed straight out of the tar,
+// so nothing is extracted to local disk.
+type TapeArchive struct {
+	Path string
+}
+
+type tapeArchiveEntry struct {
+	io.Reader
+	f io.Closer
+}
+
+func (t *tapeArchiveEntry) Close() error {
+	return t.f.Close()
+}
+
+// Open scans the tar for the entry called name and returns a reader
+// positioned at the start of its contents.
+func (t *TapeArchive) Open(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	match := func(entry string) bool {
+		return entry == name || path.Base(entry) == name
+	}
+	return t.open(ctx, match, name, -1)
+}
+
+// openMetadata looks for a file with extension ext among the package
+// metadata files only. The OVF spec requires the descriptor, manifest and
+// certificate to be the first entries of an OVA, so there is no need to read
+// past them to find out that an optional one is missing.
+func (t *TapeArchive) openMetadata(ctx context.Context, ext string) (io.ReadCloser, int64, error) {
+	return t.open(ctx, hasExtension(ext), "*"+ext, 3)
+}
+
+// open scans at most limit entries for one whose name satisfies match, or the
+// whole tar if limit is negative. description names what was looked for in
+// the error when nothing matches.
+func (t *TapeArchive) open(ctx context.Context, match func(string) bool, description string, limit int) (io.ReadCloser, int64, error) {
+	f, _, err := openSource(ctx, t.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	r := tar.NewReader(f)
+
+	for i := 0; limit < 0 || i < limit; i++ {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, 0, fmt.Errorf("failure reading %s: %s", t.Path, err)
+		}
+
+		if match(tapeEntryName(h)) {
+			return &tapeArchiveEntry{r, f}, h.Size, nil
+		}
+	}
+
+	f.Close()
+
+	return nil, 0, &FileNotFoundError{fmt.Sprintf("%s in %s", description, t.Path)}
+}
+
+// FileArchive is an OVF descriptor whose referenced files live alongside it,
+// either in the same directory or under the same URL prefix.
+type FileArchive struct {
+	Path string
+}
+
+func (f *FileArchive) base() string {
+	if u, err := url.Parse(f.Path); err == nil && IsRemote(f.Path) {
+		return path.Base(u.Path)
+	}
+	return filepath.Base(f.Path)
+}
+
+// sibling returns the name of the file next to the descriptor that shares
+// its base name but has extension ext, such as the package's .mf file.
+func (f *FileArchive) sibling(ext string) string {
+	base := f.base()
+	return strings.TrimSuffix(base, path.Ext(base)) + ext
+}
+
+// Open opens the file called name next to the descriptor.
+func (f *FileArchive) Open(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	if IsRemote(f.Path) {
+		u, err := url.Parse(f.Path)
+		if err != nil {
+			return nil, 0, err
+		}
+		// Any query string picks out the descriptor, not the files next
+		// to it.
+		u.Path = path.Join(path.Dir(u.Path), name)
+		u.RawQuery = ""
+		return openSource(ctx, u.String())
+	}
+
+	return openSource(ctx, filepath.Join(filepath.Dir(f.Path), filepath.FromSlash(name)))
+}
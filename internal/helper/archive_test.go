@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"archive/tar"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func writeTestOVA(t *testing.T, dir string, files map[string]string) string {
+	t.Helper()
+	p := filepath.Join(dir, "test.ova")
+	f, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	// The metadata goes first, as the OVF spec requires.
+	names := []string{"test.ovf", "test.mf"}
+	var rest []string
+	for name := range files {
+		if name != "test.ovf" && name != "test.mf" {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+
+	w := tar.NewWriter(f)
+	for _, name := range append(names, rest...) {
+		body, ok := files[name]
+		if !ok {
+			continue
+		}
+		if err := w.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body))}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if _, err := w.Write([]byte(body)); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return p
+}
+
+func testOpenArchive(t *testing.T, path string) Archive {
+	t.Helper()
+	archive, err := OpenArchive(context.Background(), path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return archive
+}
+
+func TestTapeArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":          "<Envelope/>",
+		"test-disk*.vmdk":   "wrong disk",
+		"test-disk1.vmdk":   "disk contents",
+		"test-disk[2].vmdk": "bracketed disk",
+	})
+
+	archive := testOpenArchive(t, p)
+	if _, ok := archive.(*TapeArchive); !ok {
+		t.Fatalf("expected TapeArchive, got %T", archive)
+	}
+
+	descriptor, err := ReadDescriptor(context.Background(), archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(descriptor) != "<Envelope/>" {
+		t.Fatalf("bad descriptor: %q", descriptor)
+	}
+
+	r, size, err := archive.Open(context.Background(), "test-disk1.vmdk")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer r.Close()
+	if size != int64(len("disk contents")) {
+		t.Fatalf("bad size: %d", size)
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(body) != "disk contents" {
+		t.Fatalf("bad contents: %q", body)
+	}
+
+	if _, _, err := archive.Open(context.Background(), "missing.vmdk"); err == nil {
+		t.Fatal("expected error opening missing entry")
+	}
+
+	testArchiveLiteralNames(t, archive)
+}
+
+// testArchiveLiteralNames checks that names with glob metacharacters are
+// opened literally.
+func testArchiveLiteralNames(t *testing.T, archive Archive) {
+	t.Helper()
+	for name, expected := range map[string]string{
+		"test-disk[2].vmdk": "bracketed disk",
+		"test-disk*.vmdk":   "wrong disk",
+	} {
+		r, _, err := archive.Open(context.Background(), name)
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		body, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatalf("%s: err: %s", name, err)
+		}
+		if string(body) != expected {
+			t.Fatalf("%s: expected %q, got %q", name, expected, body)
+		}
+	}
+}
+
+func TestFileArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, body := range map[string]string{
+		"test.ovf":          "<Envelope/>",
+		"other.ovf":         "<Other/>",
+		"test-disk*.vmdk":   "wrong disk",
+		"test-disk1.vmdk":   "disk contents",
+		"test-disk[2].vmdk": "bracketed disk",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(body), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	archive := testOpenArchive(t, filepath.Join(dir, "test.ovf"))
+	descriptor, err := ReadDescriptor(context.Background(), archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(descriptor) != "<Envelope/>" {
+		t.Fatalf("bad descriptor: %q", descriptor)
+	}
+
+	r, size, err := archive.Open(context.Background(), "test-disk1.vmdk")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.Close()
+	if size != int64(len("disk contents")) {
+		t.Fatalf("bad size: %d", size)
+	}
+
+	testArchiveLiteralNames(t, archive)
+}
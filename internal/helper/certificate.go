@@ -0,0 +1,181 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"log"
+)
+
+// Certificate policies control what happens when a package's signature can't
+// be trusted.
+const (
+	CertificatePolicyIgnore         = "ignore"
+	CertificatePolicyWarn           = "warn"
+	CertificatePolicyRequireTrusted = "require-trusted"
+)
+
+// CertificatePolicies lists the valid certificate policies.
+var CertificatePolicies = []string{
+	CertificatePolicyIgnore,
+	CertificatePolicyWarn,
+	CertificatePolicyRequireTrusted,
+}
+
+// Signature is the manifest signature shipped in a package's .cert file.
+type Signature struct {
+	Certificate *x509.Certificate
+
+	// Intermediates are the CA certificates that follow the signer's in the
+	// .cert file, used to chain it to a trusted root.
+	Intermediates []*x509.Certificate
+
+	// Err is set if the signature doesn't verify against the manifest.
+	Err error
+}
+
+// ReadSignature reads the package certificate and checks its signature over
+// the raw manifest. It returns nil if the package isn't signed.
+func ReadSignature(ctx context.Context, archive Archive, manifest []byte) (*Signature, error) {
+	raw, err := readMetadata(ctx, archive, ".cert")
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	return ParseSignature(raw, manifest)
+}
+
+// ParseSignature parses a .cert file, which holds a signature line such as
+// "SHA256(package.mf)= <hex>" followed by the PEM encoded signing
+// certificate and, optionally, its intermediate CA certificates, and verifies
+// the signature over manifest.
+func ParseSignature(raw, manifest []byte) (*Signature, error) {
+	var algorithm string
+	var sig []byte
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		if m := digestLineRegexp.FindStringSubmatch(scanner.Text()); m != nil {
+			algorithm = m[1]
+			var err error
+			if sig, err = hex.DecodeString(m[3]); err != nil {
+				return nil, fmt.Errorf("malformed signature: %s", err)
+			}
+			break
+		}
+	}
+	if sig == nil {
+		return nil, fmt.Errorf("no signature found in certificate file")
+	}
+
+	var certs []*x509.Certificate
+	for rest := raw; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM encoded certificate found in certificate file")
+	}
+	cert := certs[0]
+
+	s := &Signature{Certificate: cert, Intermediates: certs[1:]}
+	signatureAlgorithm, err := signatureAlgorithm(cert.PublicKeyAlgorithm, algorithm)
+	if err != nil {
+		s.Err = err
+	} else if err := cert.CheckSignature(signatureAlgorithm, manifest, sig); err != nil {
+		s.Err = fmt.Errorf("manifest signature does not verify: %s", err)
+	}
+	return s, nil
+}
+
+func signatureAlgorithm(key x509.PublicKeyAlgorithm, digest string) (x509.SignatureAlgorithm, error) {
+	algorithms := map[x509.PublicKeyAlgorithm]map[string]x509.SignatureAlgorithm{
+		x509.RSA: {
+			"SHA1":   x509.SHA1WithRSA,
+			"SHA256": x509.SHA256WithRSA,
+			"SHA512": x509.SHA512WithRSA,
+		},
+		x509.ECDSA: {
+			"SHA1":   x509.ECDSAWithSHA1,
+			"SHA256": x509.ECDSAWithSHA256,
+			"SHA512": x509.ECDSAWithSHA512,
+		},
+	}
+	if a, ok := algorithms[key][digest]; ok {
+		return a, nil
+	}
+	return x509.UnknownSignatureAlgorithm, fmt.Errorf("unsupported signature algorithm %s with %s key", digest, key)
+}
+
+// Trust checks that the signature is valid and that the certificate chains,
+// through the intermediates shipped with it, to one of roots, or to the system
+// roots if roots is nil.
+func (s *Signature) Trust(roots *x509.CertPool) error {
+	if s.Err != nil {
+		return s.Err
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range s.Intermediates {
+		intermediates.AddCert(cert)
+	}
+	_, err := s.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return fmt.Errorf("certificate %q is not trusted: %s", s.Certificate.Subject, err)
+	}
+	return nil
+}
+
+// EnforceCertificatePolicy decides whether an import may go ahead given the
+// package signature, which is nil for unsigned packages.
+func EnforceCertificatePolicy(s *Signature, policy string, roots *x509.CertPool) error {
+	if policy == CertificatePolicyIgnore {
+		return nil
+	}
+
+	err := fmt.Errorf("package is not signed")
+	if s != nil {
+		err = s.Trust(roots)
+	}
+	if err == nil {
+		return nil
+	}
+
+	if policy == CertificatePolicyRequireTrusted {
+		return err
+	}
+	log.Printf("[WARN] %s", err)
+	return nil
+}
+
+// LoadCABundle reads a PEM encoded bundle of CA certificates.
+func LoadCABundle(path string) (*x509.CertPool, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(contents) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return roots, nil
+}
@@ -0,0 +1,185 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func testSignedCertFile(t *testing.T, manifest []byte) ([]byte, *x509.Certificate) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Vendor"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	digest := sha256.Sum256(manifest)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	raw := fmt.Sprintf("SHA256(test.mf)= %x\n", sig)
+	raw += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	return []byte(raw), cert
+}
+
+func TestParseSignature(t *testing.T) {
+	manifest := []byte("SHA256(test.ovf)= 00\n")
+	raw, cert := testSignedCertFile(t, manifest)
+
+	s, err := ParseSignature(raw, manifest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if s.Err != nil {
+		t.Fatalf("err: %s", s.Err)
+	}
+	if s.Certificate.Subject.CommonName != "Test Vendor" {
+		t.Fatalf("bad subject: %s", s.Certificate.Subject)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	if err := s.Trust(roots); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := s.Trust(x509.NewCertPool()); err == nil {
+		t.Fatal("expected untrusted certificate")
+	}
+
+	tampered, err := ParseSignature(raw, []byte("SHA256(test.ovf)= ff\n"))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if tampered.Err == nil {
+		t.Fatal("expected signature over a tampered manifest to fail")
+	}
+	if err := tampered.Trust(roots); err == nil {
+		t.Fatal("expected tampered signature not to be trusted")
+	}
+}
+
+func TestEnforceCertificatePolicy(t *testing.T) {
+	manifest := []byte("SHA256(test.ovf)= 00\n")
+	raw, _ := testSignedCertFile(t, manifest)
+	s, err := ParseSignature(raw, manifest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	untrusted := x509.NewCertPool()
+
+	for _, tc := range []struct {
+		policy    string
+		signature *Signature
+		fails     bool
+	}{
+		{CertificatePolicyIgnore, nil, false},
+		{CertificatePolicyWarn, nil, false},
+		{CertificatePolicyWarn, s, false},
+		{CertificatePolicyRequireTrusted, nil, true},
+		{CertificatePolicyRequireTrusted, s, true},
+	} {
+		err := EnforceCertificatePolicy(tc.signature, tc.policy, untrusted)
+		if (err != nil) != tc.fails {
+			t.Fatalf("%s (signed: %t): unexpected result %v", tc.policy, tc.signature != nil, err)
+		}
+	}
+}
+
+func testCreateCert(t *testing.T, name string, isCA bool, parent *x509.Certificate, parentKey *rsa.PrivateKey) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return cert, key
+}
+
+func TestParseSignature_intermediates(t *testing.T) {
+	root, rootKey := testCreateCert(t, "Test Root CA", true, nil, nil)
+	intermediate, intermediateKey := testCreateCert(t, "Test Intermediate CA", true, root, rootKey)
+	leaf, leafKey := testCreateCert(t, "Test Vendor", false, intermediate, intermediateKey)
+
+	manifest := []byte("SHA256(test.ovf)= 00\n")
+	digest := sha256.Sum256(manifest)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, leafKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	raw := fmt.Sprintf("SHA256(test.mf)= %x\n", sig)
+	for _, cert := range []*x509.Certificate{leaf, intermediate} {
+		raw += string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+	}
+
+	s, err := ParseSignature([]byte(raw), manifest)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if s.Err != nil {
+		t.Fatalf("err: %s", s.Err)
+	}
+	if s.Certificate.Subject.CommonName != "Test Vendor" {
+		t.Fatalf("bad signer: %s", s.Certificate.Subject)
+	}
+	if len(s.Intermediates) != 1 || s.Intermediates[0].Subject.CommonName != "Test Intermediate CA" {
+		t.Fatalf("bad intermediates: %v", s.Intermediates)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	if err := s.Trust(roots); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := EnforceCertificatePolicy(s, CertificatePolicyRequireTrusted, roots); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
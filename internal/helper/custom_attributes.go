@@ -0,0 +1,88 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// adapted from tf vsphere provider internals
+
+// CustomAttributes returns the custom attribute values set on an entity,
+// keyed by attribute ID. Attributes set to the empty string count as unset.
+func CustomAttributes(entity *mo.ManagedEntity) map[string]string {
+	attrs := map[string]string{}
+	for _, v := range entity.CustomValue {
+		if s, ok := v.(*types.CustomFieldStringValue); ok && s.Value != "" {
+			attrs[strconv.Itoa(int(s.Key))] = s.Value
+		}
+	}
+	return attrs
+}
+
+// ApplyCustomAttributes sets the custom attributes in new on a virtual
+// machine and clears the ones only in old.
+func ApplyCustomAttributes(client *govmomi.Client, vm *object.VirtualMachine, old, new map[string]string) error {
+	if !IsVirtualCenter(client) {
+		return fmt.Errorf("custom attributes are only supported on vCenter")
+	}
+
+	changes, err := customAttributeChanges(old, new)
+	if err != nil {
+		return err
+	}
+
+	fm, err := object.GetCustomFieldsManager(client.Client)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+	for key, value := range changes {
+		if err := fm.Set(ctx, vm.Reference(), key, value); err != nil {
+			return fmt.Errorf("failure setting custom attribute %d: %s", key, err)
+		}
+	}
+	return nil
+}
+
+// customAttributeChanges works out the values to set, by attribute key, to
+// get from old to new. Removed attributes are cleared by setting them to the
+// empty string.
+func customAttributeChanges(old, new map[string]string) (map[int32]string, error) {
+	changes := map[int32]string{}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			key, err := parseCustomAttributeKey(k)
+			if err != nil {
+				return nil, err
+			}
+			changes[key] = ""
+		}
+	}
+	for k, v := range new {
+		if old[k] == v {
+			continue
+		}
+		key, err := parseCustomAttributeKey(k)
+		if err != nil {
+			return nil, err
+		}
+		changes[key] = v
+	}
+	return changes, nil
+}
+
+func parseCustomAttributeKey(k string) (int32, error) {
+	key, err := strconv.ParseInt(k, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("custom attribute ID %q is not a number", k)
+	}
+	return int32(key), nil
+}
@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCustomAttributeChanges(t *testing.T) {
+	changes, err := customAttributeChanges(
+		map[string]string{"101": "build-1", "102": "abc123", "103": "same"},
+		map[string]string{"101": "build-2", "103": "same", "104": "new"},
+	)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := map[int32]string{101: "build-2", 102: "", 104: "new"}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Fatalf("expected %v, got %v", expected, changes)
+	}
+
+	if _, err := customAttributeChanges(nil, map[string]string{"build": "1"}); err == nil {
+		t.Fatal("expected non-numeric attribute ID to fail")
+	}
+}
+
+func TestMissingFrom(t *testing.T) {
+	missing := missingFrom([]string{"tag-1", "tag-2", "tag-3"}, []string{"tag-2"})
+	if !reflect.DeepEqual(missing, []string{"tag-1", "tag-3"}) {
+		t.Fatalf("bad: %v", missing)
+	}
+	if missing := missingFrom([]string{"tag-1"}, []string{"tag-1"}); len(missing) != 0 {
+		t.Fatalf("bad: %v", missing)
+	}
+}
@@ -0,0 +1,209 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+// CIM resource types of the virtual hardware items we summarize.
+const (
+	resourceTypeProcessor = 3
+	resourceTypeMemory    = 4
+)
+
+var allocationUnitsRegexp = regexp.MustCompile(`^byte\s*(?:\*\s*2\s*\^\s*(\d+))?$`)
+
+// DeploymentOptions returns the IDs of the deployment configurations declared
+// in the envelope's DeploymentOptionSection.
+func DeploymentOptions(envelope *ovf.Envelope) []string {
+	var ids []string
+	if envelope.DeploymentOption != nil {
+		for _, c := range envelope.DeploymentOption.Configuration {
+			ids = append(ids, c.ID)
+		}
+	}
+	return ids
+}
+
+// DefaultDeploymentOption returns the deployment configuration vCenter would
+// pick when none is requested: the one flagged as default, or else the first
+// one declared. It returns an empty string if the envelope has none.
+func DefaultDeploymentOption(envelope *ovf.Envelope) string {
+	if envelope.DeploymentOption == nil || len(envelope.DeploymentOption.Configuration) == 0 {
+		return ""
+	}
+	for _, c := range envelope.DeploymentOption.Configuration {
+		if c.Default != nil && *c.Default {
+			return c.ID
+		}
+	}
+	return envelope.DeploymentOption.Configuration[0].ID
+}
+
+// ValidateDeploymentOption checks that option is one of the deployment
+// configurations declared in the envelope. An empty option is always valid.
+func ValidateDeploymentOption(envelope *ovf.Envelope, option string) error {
+	if option == "" {
+		return nil
+	}
+
+	ids := DeploymentOptions(envelope)
+	for _, id := range ids {
+		if id == option {
+			return nil
+		}
+	}
+
+	if len(ids) == 0 {
+		return fmt.Errorf("deployment option %q requested, but the ovf declares no deployment options", option)
+	}
+	return fmt.Errorf("deployment option %q must be one of %q", option, ids)
+}
+
+// AllocationUnits returns the number of bytes in one of the programmatic
+// units OVF uses for sizes, such as "byte * 2^30". An empty string means
+// bytes.
+func AllocationUnits(units string) (int64, error) {
+	units = strings.TrimSpace(units)
+	if units == "" {
+		return 1, nil
+	}
+
+	m := allocationUnitsRegexp.FindStringSubmatch(units)
+	if m == nil {
+		return 0, fmt.Errorf("unsupported allocation units %q", units)
+	}
+	if m[1] == "" {
+		return 1, nil
+	}
+	exp, err := strconv.Atoi(m[1])
+	if err != nil || exp > 62 {
+		return 0, fmt.Errorf("unsupported allocation units %q", units)
+	}
+	return 1 << uint(exp), nil
+}
+
+// DiskCapacity returns the capacity of a disk in bytes.
+func DiskCapacity(disk ovf.VirtualDiskDesc) (int64, error) {
+	var units string
+	if disk.CapacityAllocationUnits != nil {
+		units = *disk.CapacityAllocationUnits
+	}
+	multiplier, err := AllocationUnits(units)
+	if err != nil {
+		return 0, fmt.Errorf("disk %q: %s", disk.DiskID, err)
+	}
+
+	capacity, err := strconv.ParseInt(disk.Capacity, 10, 64)
+	if err != nil {
+		// The capacity may reference a property, which only has a value once
+		// the OVF is deployed.
+		return 0, fmt.Errorf("disk %q: capacity %q is not a number", disk.DiskID, disk.Capacity)
+	}
+	return capacity * multiplier, nil
+}
+
+// OperatingSystem returns the guest OS the envelope declares, or nil if it
+// doesn't declare one.
+func OperatingSystem(envelope *ovf.Envelope) *ovf.OperatingSystemSection {
+	if envelope.OperatingSystem != nil {
+		return envelope.OperatingSystem
+	}
+	if envelope.VirtualSystem != nil && len(envelope.VirtualSystem.OperatingSystem) > 0 {
+		return &envelope.VirtualSystem.OperatingSystem[0]
+	}
+	return nil
+}
+
+// EULAs returns the text of every license agreement in the envelope.
+func EULAs(envelope *ovf.Envelope) []string {
+	var sections []ovf.EulaSection
+	if envelope.Eula != nil {
+		sections = append(sections, *envelope.Eula)
+	}
+	if envelope.VirtualSystem != nil {
+		sections = append(sections, envelope.VirtualSystem.Eula...)
+	}
+
+	var licenses []string
+	for _, s := range sections {
+		licenses = append(licenses, strings.TrimSpace(s.License))
+	}
+	return licenses
+}
+
+// VirtualHardware summarizes a VirtualHardwareSection.
+type VirtualHardware struct {
+	// Version is the virtual hardware family, such as vmx-13.
+	Version  string
+	NumCPUs  int
+	MemoryMB int64
+}
+
+// VirtualHardwareSections summarizes the envelope's virtual hardware as it
+// would be deployed with the given deployment option, which defaults to the
+// envelope's default.
+func VirtualHardwareSections(envelope *ovf.Envelope, option string) ([]VirtualHardware, error) {
+	if option == "" {
+		option = DefaultDeploymentOption(envelope)
+	}
+
+	var sections []ovf.VirtualHardwareSection
+	if envelope.VirtualHardware != nil {
+		sections = append(sections, *envelope.VirtualHardware)
+	}
+	if envelope.VirtualSystem != nil {
+		sections = append(sections, envelope.VirtualSystem.VirtualHardware...)
+	}
+
+	var hardware []VirtualHardware
+	for _, s := range sections {
+		var h VirtualHardware
+		if s.System != nil && s.System.VirtualSystemType != nil {
+			h.Version = *s.System.VirtualSystemType
+		}
+
+		for _, item := range s.Item {
+			if !itemInConfiguration(item, option) || item.ResourceType == nil || item.VirtualQuantity == nil {
+				continue
+			}
+
+			switch *item.ResourceType {
+			case resourceTypeProcessor:
+				h.NumCPUs = int(*item.VirtualQuantity)
+			case resourceTypeMemory:
+				units := "byte * 2^20"
+				if item.AllocationUnits != nil {
+					units = *item.AllocationUnits
+				}
+				multiplier, err := AllocationUnits(units)
+				if err != nil {
+					return nil, fmt.Errorf("memory: %s", err)
+				}
+				h.MemoryMB = int64(*item.VirtualQuantity) * multiplier >> 20
+			}
+		}
+
+		hardware = append(hardware, h)
+	}
+	return hardware, nil
+}
+
+// itemInConfiguration reports whether a virtual hardware item applies to a
+// deployment option. Items without a configuration attribute apply to all of
+// them.
+func itemInConfiguration(item ovf.ResourceAllocationSettingData, option string) bool {
+	if item.Configuration == nil {
+		return true
+	}
+	for _, c := range strings.Fields(*item.Configuration) {
+		if c == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+)
+
+const testDeploymentOptionDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <DeploymentOptionSection>
+    <Info>Sizes</Info>
+    <Configuration ovf:id="small">
+      <Label>Small</Label>
+      <Description>2 vCPU</Description>
+    </Configuration>
+    <Configuration ovf:id="medium" ovf:default="true">
+      <Label>Medium</Label>
+      <Description>4 vCPU</Description>
+    </Configuration>
+    <Configuration ovf:id="large">
+      <Label>Large</Label>
+      <Description>8 vCPU</Description>
+    </Configuration>
+  </DeploymentOptionSection>
+</Envelope>`
+
+func TestDeploymentOptions(t *testing.T) {
+	envelope := testEnvelope(t, testDeploymentOptionDescriptor)
+
+	expected := []string{"small", "medium", "large"}
+	if actual := DeploymentOptions(envelope); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %v, got %v", expected, actual)
+	}
+
+	if actual := DefaultDeploymentOption(envelope); actual != "medium" {
+		t.Fatalf("expected default medium, got %q", actual)
+	}
+
+	if err := ValidateDeploymentOption(envelope, "large"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ValidateDeploymentOption(envelope, "huge"); err == nil {
+		t.Fatal("expected error validating an undeclared deployment option")
+	}
+}
+
+func TestDeploymentOptions_none(t *testing.T) {
+	envelope := testEnvelope(t, testNetworkDescriptor)
+
+	if actual := DefaultDeploymentOption(envelope); actual != "" {
+		t.Fatalf("expected no default, got %q", actual)
+	}
+	if err := ValidateDeploymentOption(envelope, ""); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := ValidateDeploymentOption(envelope, "small"); err == nil {
+		t.Fatal("expected error requesting a deployment option from an ovf without any")
+	}
+}
+
+const testHardwareDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1" xmlns:rasd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_ResourceAllocationSettingData" xmlns:vssd="http://schemas.dmtf.org/wbem/wscim/1/cim-schema/2/CIM_VirtualSystemSettingData">
+  <DiskSection>
+    <Info>Disks</Info>
+    <Disk ovf:diskId="vmdisk1" ovf:fileRef="file1" ovf:capacity="16" ovf:capacityAllocationUnits="byte * 2^30" ovf:format="http://www.vmware.com/interfaces/specifications/vmdk.html#streamOptimized"/>
+  </DiskSection>
+  <DeploymentOptionSection>
+    <Info>Sizes</Info>
+    <Configuration ovf:id="small" ovf:default="true"><Label>Small</Label></Configuration>
+    <Configuration ovf:id="large"><Label>Large</Label></Configuration>
+  </DeploymentOptionSection>
+  <VirtualSystem ovf:id="vm">
+    <Info>A virtual machine</Info>
+    <OperatingSystemSection ovf:id="101" ovf:osType="ubuntu64Guest">
+      <Info>The guest OS</Info>
+    </OperatingSystemSection>
+    <EulaSection>
+      <Info>License</Info>
+      <License>
+        You agree to everything.
+      </License>
+    </EulaSection>
+    <VirtualHardwareSection>
+      <Info>Hardware</Info>
+      <System>
+        <vssd:VirtualSystemType>vmx-13</vssd:VirtualSystemType>
+      </System>
+      <Item ovf:configuration="small">
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>2</rasd:VirtualQuantity>
+      </Item>
+      <Item ovf:configuration="large">
+        <rasd:ResourceType>3</rasd:ResourceType>
+        <rasd:VirtualQuantity>8</rasd:VirtualQuantity>
+      </Item>
+      <Item>
+        <rasd:AllocationUnits>byte * 2^30</rasd:AllocationUnits>
+        <rasd:ResourceType>4</rasd:ResourceType>
+        <rasd:VirtualQuantity>4</rasd:VirtualQuantity>
+      </Item>
+    </VirtualHardwareSection>
+  </VirtualSystem>
+</Envelope>`
+
+func TestVirtualHardwareSections(t *testing.T) {
+	envelope := testEnvelope(t, testHardwareDescriptor)
+
+	hardware, err := VirtualHardwareSections(envelope, "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	expected := []VirtualHardware{{Version: "vmx-13", NumCPUs: 2, MemoryMB: 4096}}
+	if !reflect.DeepEqual(hardware, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, hardware)
+	}
+
+	hardware, err = VirtualHardwareSections(envelope, "large")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if hardware[0].NumCPUs != 8 {
+		t.Fatalf("expected 8 CPUs for the large configuration, got %d", hardware[0].NumCPUs)
+	}
+}
+
+func TestDiskCapacity(t *testing.T) {
+	envelope := testEnvelope(t, testHardwareDescriptor)
+
+	capacity, err := DiskCapacity(envelope.Disk.Disks[0])
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if capacity != 16<<30 {
+		t.Fatalf("expected 16GiB, got %d", capacity)
+	}
+
+	for units, expected := range map[string]int64{"": 1, "byte": 1, "byte*2^20": 1 << 20, "byte * 2^10": 1 << 10} {
+		actual, err := AllocationUnits(units)
+		if err != nil {
+			t.Fatalf("%q: %s", units, err)
+		}
+		if actual != expected {
+			t.Fatalf("%q: expected %d, got %d", units, expected, actual)
+		}
+	}
+	if _, err := AllocationUnits("furlongs"); err == nil {
+		t.Fatal("expected error parsing unknown units")
+	}
+}
+
+func TestOperatingSystemAndEULAs(t *testing.T) {
+	envelope := testEnvelope(t, testHardwareDescriptor)
+
+	os := OperatingSystem(envelope)
+	if os == nil || os.OSType == nil || *os.OSType != "ubuntu64Guest" {
+		t.Fatalf("bad operating system: %+v", os)
+	}
+
+	expected := []string{"You agree to everything."}
+	if actual := EULAs(envelope); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+	if actual := EULAs(testEnvelope(t, testNetworkDescriptor)); len(actual) != 0 {
+		t.Fatalf("expected no EULAs, got %q", actual)
+	}
+}
@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+// eulaExcerptLength is how much of a license is quoted when asking for it to
+// be accepted.
+const eulaExcerptLength = 400
+
+// EULADigest returns the sha256 digest of the license agreements in the
+// envelope, formatted like a checksum, or an empty string if there are none.
+func EULADigest(envelope *ovf.Envelope) string {
+	licenses := EULAs(envelope)
+	if len(licenses) == 0 {
+		return ""
+	}
+
+	h := sha256.New()
+	for _, l := range licenses {
+		fmt.Fprintf(h, "%s\x00", l)
+	}
+	return fmt.Sprintf("sha256:%x", h.Sum(nil))
+}
+
+// CheckEULA makes sure the envelope's license agreements, if any, have been
+// accepted. When acceptedDigest is set, the licenses must also be exactly
+// the ones it was taken from, so a changed license has to be accepted again.
+// It returns the digest of the licenses.
+func CheckEULA(envelope *ovf.Envelope, accepted bool, acceptedDigest string) (string, error) {
+	digest := EULADigest(envelope)
+	if digest == "" {
+		return "", nil
+	}
+
+	if !accepted {
+		return "", fmt.Errorf("the ovf contains a license agreement (%s) that must be accepted with accept_eula:\n\n%s", digest, eulaExcerpt(envelope))
+	}
+	if acceptedDigest != "" && acceptedDigest != digest {
+		return "", fmt.Errorf("the ovf's license agreement has changed from the accepted %s to %s; review it and set eula_digest to accept it:\n\n%s", acceptedDigest, digest, eulaExcerpt(envelope))
+	}
+	return digest, nil
+}
+
+func eulaExcerpt(envelope *ovf.Envelope) string {
+	text := strings.Join(strings.Fields(strings.Join(EULAs(envelope), "\n\n")), " ")
+	if runes := []rune(text); len(runes) > eulaExcerptLength {
+		text = string(runes[:eulaExcerptLength]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,55 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+func TestCheckEULA(t *testing.T) {
+	envelope := testEnvelope(t, testHardwareDescriptor)
+	digest := EULADigest(envelope)
+	if !strings.HasPrefix(digest, "sha256:") {
+		t.Fatalf("bad digest: %q", digest)
+	}
+
+	_, err := CheckEULA(envelope, false, "")
+	if err == nil {
+		t.Fatal("expected an unaccepted license to fail")
+	}
+	if !strings.Contains(err.Error(), digest) || !strings.Contains(err.Error(), "You agree to everything.") {
+		t.Fatalf("expected the digest and an excerpt in the error, got %q", err)
+	}
+
+	if actual, err := CheckEULA(envelope, true, ""); err != nil || actual != digest {
+		t.Fatalf("expected %q, got %q (err: %v)", digest, actual, err)
+	}
+	if _, err := CheckEULA(envelope, true, digest); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := CheckEULA(envelope, true, "sha256:00"); err == nil {
+		t.Fatal("expected a changed license to need accepting again")
+	}
+
+	if actual, err := CheckEULA(testEnvelope(t, testNetworkDescriptor), false, ""); err != nil || actual != "" {
+		t.Fatalf("expected no license to need no acceptance, got %q (err: %v)", actual, err)
+	}
+}
+
+func TestEULAExcerpt(t *testing.T) {
+	// Every rune is two bytes, so a byte cut at an even length still lands
+	// on a boundary; the leading 'a' shifts them all by one.
+	license := "a" + strings.Repeat("é", eulaExcerptLength)
+	envelope := &ovf.Envelope{Eula: &ovf.EulaSection{License: license}}
+
+	excerpt := eulaExcerpt(envelope)
+	if !utf8.ValidString(excerpt) {
+		t.Fatalf("expected valid UTF-8, got %q", excerpt)
+	}
+	expected := string([]rune(license)[:eulaExcerptLength]) + "..."
+	if excerpt != expected {
+		t.Fatalf("expected %q, got %q", expected, excerpt)
+	}
+}
@@ -1,57 +1,129 @@
 package helper
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io/ioutil"
-	"os"
-	"path/filepath"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
 
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/nfc"
 	"github.com/vmware/govmomi/object"
 	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/soap"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
+// SourceChecksumKey is the extraConfig key an imported VM records the
+// checksum of its source package under.
+const SourceChecksumKey = "ova.source.checksum"
+
+// SourceDescriptorKey is the extraConfig key an imported VM records the
+// digest of its OVF descriptor under. Every import records it.
+const SourceDescriptorKey = "ova.source.descriptor"
+
+// ImportOptions holds the knobs that control how an OVF is imported.
+type ImportOptions struct {
+	// Name is the name of the imported VM. When empty, the name in the OVF is
+	// used.
+	Name string
+
+	// MarkAsTemplate converts the imported VM into a template once the upload
+	// has completed.
+	MarkAsTemplate bool
+
+	// NetworkMappings maps OVF network names to the path or ID of the vSphere
+	// network they should be attached to.
+	NetworkMappings map[string]string
+
+	// DefaultNetwork is the path or ID of the vSphere network used for any OVF
+	// network not listed in NetworkMappings. When empty, unmapped networks are
+	// looked up by their OVF name.
+	DefaultNetwork string
+
+	// Properties sets the values of ProductSection properties, keyed by
+	// property ID.
+	Properties map[string]string
+
+	// DeploymentOption selects a configuration from the OVF's
+	// DeploymentOptionSection. When empty, the OVF's default is used.
+	DeploymentOption string
+
+	// DiskProvisioning is the provisioning type for the imported disks, one of
+	// the OvfCreateImportSpecParamsDiskProvisioningType values. When empty,
+	// vCenter picks.
+	DiskProvisioning string
+
+	// StorageProfileID is the ID of a VM storage policy to apply to the
+	// imported VM and its disks.
+	StorageProfileID string
+
+	// Parallelism is the maximum number of files uploaded at once. Values
+	// below one mean one. A remote OVA, or one with a checksum, is always
+	// uploaded one file at a time, since it is read in a single pass.
+	Parallelism int
+
+	// Annotation replaces the notes the OVF gives the imported VM. When
+	// empty, the OVF's notes are kept.
+	Annotation string
+
+	// Host is the host to import onto. When nil, vCenter picks one from the
+	// resource pool's cluster.
+	Host *object.HostSystem
+
+	// SourceChecksum is recorded in the imported VM's extraConfig, so where
+	// it came from can be looked up later.
+	SourceChecksum string
+}
+
+// Import imports an opened OVF package into the given resource pool,
+// datastore and folder, returning the resulting virtual machine.
 func Import(ctx context.Context,
-	ovfPath string,
-	// networkMapOverrides map[string]string,
+	pkg *Package,
 	client *govmomi.Client,
 	resourcePool *object.ResourcePool,
 	dataStore *object.Datastore,
 	dc *object.Datacenter,
 	folder *object.Folder,
-) ([]string, error) {
-	contents, err := ioutil.ReadFile(ovfPath)
-	if err != nil {
-		return nil, fmt.Errorf("failure reading file: %s", err)
-	}
+	opts ImportOptions,
+) (*object.VirtualMachine, error) {
+	envelope := pkg.Envelope
 
-	envelope, err := ovf.Unmarshal(bytes.NewReader(contents))
+	networks, err := NetworkMappings(envelope, opts.NetworkMappings, opts.DefaultNetwork)
 	if err != nil {
-		return nil, fmt.Errorf("failure unmarshalling ovf: %s", err)
+		return nil, err
 	}
 
-	// upsert network mappings
-	networks := map[string]string{}
-	if envelope.Network != nil {
-		for _, net := range envelope.Network.Networks {
-			networks[net.Name] = net.Name // this needs a remap
-		}
+	if err := ValidateProperties(envelope, opts.Properties); err != nil {
+		return nil, err
+	}
+	if err := ValidateDeploymentOption(envelope, opts.DeploymentOption); err != nil {
+		return nil, err
 	}
-	// for original, new := range networkMapOverrides {
-	// 	networks[original] = new // this needs a remap
-	// }
 
 	// form real network map with object references
-	isp := types.OvfCreateImportSpecParams{NetworkMapping: []types.OvfNetworkMapping{}}
+	isp := types.OvfCreateImportSpecParams{
+		EntityName:       opts.Name,
+		NetworkMapping:   []types.OvfNetworkMapping{},
+		PropertyMapping:  PropertyMapping(opts.Properties),
+		DiskProvisioning: opts.DiskProvisioning,
+		OvfManagerCommonParams: types.OvfManagerCommonParams{
+			DeploymentOption: opts.DeploymentOption,
+		},
+	}
+	if opts.Host != nil {
+		host := opts.Host.Reference()
+		isp.HostSystem = &host
+	}
 	for src, dst := range networks {
-		net, err := Network(client, dc, dst)
+		net, err := NetworkFromPathOrID(client, dc, dst)
 		if err != nil {
-			return nil, fmt.Errorf("failed finding network", err)
+			return nil, fmt.Errorf("failed finding network for %q: %s", src, err)
 		}
 		isp.NetworkMapping = append(isp.NetworkMapping, types.OvfNetworkMapping{
 			Name:    src,
@@ -61,21 +133,73 @@ func Import(ctx context.Context,
 
 	// create an ovf manager, use it to create an import spec out of our CreateImportSpecParams
 	manager := ovf.NewManager(client.Client)
-	spec, err := manager.CreateImportSpec(ctx, string(contents), resourcePool, dataStore, isp)
+	spec, err := manager.CreateImportSpec(ctx, string(pkg.Descriptor), resourcePool, dataStore, isp)
 	if err != nil {
 		return nil, fmt.Errorf("failure creating import spec: %s", err)
 	}
-	if spec.Error != nil {
-		return nil, fmt.Errorf("failure in import spec %+v\n%s\n", isp, spec.Error[0].LocalizedMessage)
+	logFaults("import spec", spec.Warning)
+	if len(spec.Error) > 0 {
+		return nil, fmt.Errorf("failure in import spec:\n\t%s", strings.Join(faultMessages("import spec", spec.Error), "\n\t"))
+	}
+
+	if opts.StorageProfileID != "" {
+		if err := applyStorageProfile(spec.ImportSpec, opts.StorageProfileID); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Annotation != "" {
+		if err := applyAnnotation(spec.ImportSpec, opts.Annotation); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SourceChecksum != "" {
+		if err := applyExtraConfig(spec.ImportSpec, SourceChecksumKey, opts.SourceChecksum); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyExtraConfig(spec.ImportSpec, SourceDescriptorKey, pkg.DescriptorDigest()); err != nil {
+		return nil, err
 	}
 
 	// do a dance to execute the uploads
-	lease, err := resourcePool.ImportVApp(ctx, spec.ImportSpec, folder, nil)
+	lease, err := resourcePool.ImportVApp(ctx, spec.ImportSpec, folder, opts.Host)
 	if err != nil {
 		return nil, fmt.Errorf("failure importing vapp: %s", err)
 	}
 
-	info, err := lease.Wait(ctx, spec.FileItem)
+	// From here on vCenter has created the VM shell, so every failure has to
+	// abort the lease and remove the shell, or a retry will find the name
+	// taken. ctx may already be cancelled by then, so the cleanup gets its
+	// own.
+	entity, err := runLease(ctx, client.Client.Client, lease, pkg, spec.FileItem, opts.Parallelism)
+	if err != nil {
+		abortLease(lease, err)
+		if entity == nil {
+			entity = leaseEntity(client, lease)
+		}
+		if entity != nil {
+			removeImportedVM(object.NewVirtualMachine(client.Client, *entity))
+		}
+		return nil, err
+	}
+
+	vm := object.NewVirtualMachine(client.Client, *entity)
+
+	if opts.MarkAsTemplate {
+		if err := MarkAsTemplate(ctx, vm); err != nil {
+			removeImportedVM(vm)
+			return nil, fmt.Errorf("failure marking as template: %s", err)
+		}
+	}
+
+	return vm, nil
+}
+
+// runLease waits for the lease, uploads the package files and completes it,
+// returning the imported entity. The entity is nil if the lease failed before
+// vCenter reported it.
+func runLease(ctx context.Context, client *soap.Client, lease *nfc.Lease, pkg *Package, items []types.OvfFileItem, parallelism int) (*types.ManagedObjectReference, error) {
+	info, err := lease.Wait(ctx, items)
 	if err != nil {
 		return nil, fmt.Errorf("failure waiting on lease: %s", err)
 	}
@@ -83,35 +207,293 @@ func Import(ctx context.Context,
 	updater := lease.StartUpdater(ctx, info)
 	defer updater.Done()
 
-	itemURLs := []string{}
-	for _, i := range info.Items {
-		err = upload(ctx, lease, ovfPath, i)
-		if err != nil {
-			return nil, fmt.Errorf("failure uploading: %s", err)
+	// A local OVA is indexed so its files can be read concurrently. A remote
+	// one is read once, start to end, rather than downloaded again for every
+	// file, and so is one with a checksum: that lets the checksum cover the
+	// bytes that are uploaded, checked before the lease completes.
+	archive := pkg.Archive
+	var stream *tapeStream
+	if t, ok := archive.(*TapeArchive); ok {
+		if pkg.Checksum == nil && !IsRemote(t.Path) {
+			index, err := newTapeIndex(t, pkg)
+			if err != nil {
+				return &info.Entity, err
+			}
+			defer index.Close()
+			archive = index
+		} else {
+			if parallelism > 1 {
+				log.Printf("[WARN] ova upload: %s is read in a single pass, since it is remote or has a checksum, so its files are uploaded one at a time instead of %d at once", t.Path, parallelism)
+			}
+			stream, err = newTapeStream(ctx, t, pkg)
+			if err != nil {
+				return &info.Entity, err
+			}
+			defer stream.Close()
+			archive, parallelism = stream, 1
 		}
-		itemURLs = append(itemURLs, i.URL.String())
 	}
 
-	return itemURLs, lease.Complete(ctx)
+	if err := uploadAll(ctx, client, archive, pkg, info.Items, parallelism); err != nil {
+		return &info.Entity, fmt.Errorf("failure uploading: %s", err)
+	}
+
+	if stream != nil {
+		if err := stream.Finish(); err != nil {
+			return &info.Entity, err
+		}
+	}
+
+	if err := lease.Complete(ctx); err != nil {
+		return &info.Entity, fmt.Errorf("failure completing lease: %s", err)
+	}
+
+	return &info.Entity, nil
 }
 
-// TODO: do we have to do anything special if the file is a tarball? answer: almost certainly yes...
-func upload(ctx context.Context, lease *nfc.Lease, ovfPath string, item nfc.FileItem) error {
-	file, err := os.Open(filepath.Join(filepath.Dir(ovfPath), item.Path))
-	if err != nil {
-		return err
+// NetworkMappings resolves every network declared in the envelope to the
+// vSphere network it should be mapped to. Explicit mappings win, then the
+// default network, then a network with the same name as the OVF network.
+func NetworkMappings(envelope *ovf.Envelope, mappings map[string]string, defaultNetwork string) (map[string]string, error) {
+	networks := map[string]string{}
+	if envelope.Network != nil {
+		for _, net := range envelope.Network.Networks {
+			networks[net.Name] = net.Name
+			if defaultNetwork != "" {
+				networks[net.Name] = defaultNetwork
+			}
+		}
+	}
+
+	for src, dst := range mappings {
+		if _, ok := networks[src]; !ok {
+			return nil, fmt.Errorf("network %q is not declared in the ovf", src)
+		}
+		networks[src] = dst
 	}
-	defer file.Close()
 
-	fileInfo, err := file.Stat()
+	return networks, nil
+}
+
+// applyStorageProfile attaches a VM storage policy to the VM and to every disk
+// in the import spec.
+func applyStorageProfile(spec types.BaseImportSpec, profileID string) error {
+	vmSpec, ok := spec.(*types.VirtualMachineImportSpec)
+	if !ok {
+		return fmt.Errorf("storage profiles can only be applied to single virtual machine imports, got %T", spec)
+	}
+
+	profile := []types.BaseVirtualMachineProfileSpec{
+		&types.VirtualMachineDefinedProfileSpec{ProfileId: profileID},
+	}
+
+	vmSpec.ConfigSpec.VmProfile = profile
+	for _, change := range vmSpec.ConfigSpec.DeviceChange {
+		deviceSpec := change.GetVirtualDeviceConfigSpec()
+		if _, ok := deviceSpec.Device.(*types.VirtualDisk); ok {
+			deviceSpec.Profile = profile
+		}
+	}
+
+	return nil
+}
+
+// applyAnnotation sets the notes of the VM in the import spec.
+func applyAnnotation(spec types.BaseImportSpec, annotation string) error {
+	vmSpec, ok := spec.(*types.VirtualMachineImportSpec)
+	if !ok {
+		return fmt.Errorf("annotations can only be applied to single virtual machine imports, got %T", spec)
+	}
+	vmSpec.ConfigSpec.Annotation = annotation
+	return nil
+}
+
+// applyExtraConfig adds an extraConfig option to the VM in the import spec.
+func applyExtraConfig(spec types.BaseImportSpec, key, value string) error {
+	vmSpec, ok := spec.(*types.VirtualMachineImportSpec)
+	if !ok {
+		return fmt.Errorf("extraConfig can only be applied to single virtual machine imports, got %T", spec)
+	}
+	vmSpec.ConfigSpec.ExtraConfig = append(vmSpec.ConfigSpec.ExtraConfig, &types.OptionValue{Key: key, Value: value})
+	return nil
+}
+
+// abortLease aborts the lease with a fault carrying err's message, so vCenter
+// stops waiting on the upload and releases the entity being imported.
+func abortLease(lease *nfc.Lease, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	fault := &types.LocalizedMethodFault{
+		Fault:            &types.SystemError{Reason: err.Error()},
+		LocalizedMessage: err.Error(),
+	}
+	if abortErr := lease.Abort(ctx, fault); abortErr != nil {
+		log.Printf("[WARN] failure aborting lease: %s", abortErr)
+	}
+}
+
+// leaseEntity asks vCenter for the entity a lease was importing, for when the
+// lease failed before handing it over. It returns nil if there isn't one.
+func leaseEntity(client *govmomi.Client, lease *nfc.Lease) *types.ManagedObjectReference {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	var l mo.HttpNfcLease
+	pc := property.DefaultCollector(client.Client)
+	if err := pc.RetrieveOne(ctx, lease.Reference(), []string{"info"}, &l); err != nil {
+		log.Printf("[WARN] failure looking up lease entity: %s", err)
+		return nil
+	}
+	if l.Info == nil {
+		return nil
+	}
+	return &l.Info.Entity
+}
+
+// removeImportedVM destroys what is left of a failed import. vCenter usually
+// discards the entity of an aborted lease itself, so a VM that is already
+// gone is fine.
+func removeImportedVM(vm *object.VirtualMachine) {
+	if _, err := Properties(vm); err != nil {
+		if !IsManagedObjectNotFoundError(err) {
+			log.Printf("[WARN] failure looking up partially imported virtual machine %s: %s", vm.Reference().Value, err)
+		}
+		return
+	}
+	// The import's own context is usually done by now, so cleaning up gets a
+	// fresh one.
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+	if err := Destroy(ctx, vm); err != nil {
+		log.Printf("[WARN] failure removing partially imported virtual machine %s, it has to be deleted by hand: %s", vm.Reference().Value, err)
+	}
+}
+
+// uploadAll uploads the lease items concurrently, at most parallelism at a
+// time, reading the package files from archive. Items are started in the
+// order the descriptor lists their files, which is the order an OVA stores
+// them in. The first failure cancels the uploads still in flight and is
+// returned.
+func uploadAll(ctx context.Context, client *soap.Client, archive Archive, pkg *Package, items []nfc.FileItem, parallelism int) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	files := map[string]ovf.File{}
+	order := map[string]int{}
+	for i, f := range pkg.Envelope.References {
+		files[f.Href] = f
+		order[f.Href] = i
+	}
+
+	items = append([]nfc.FileItem{}, items...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return order[items[i].Path] < order[items[j].Path]
+	})
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	progress := newUploadProgress(items)
+	go progress.run(ctx, uploadProgressInterval)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	sem := make(chan struct{}, parallelism)
+
+	for _, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		file, ok := files[item.Path]
+		if !ok {
+			file = ovf.File{Href: item.Path}
+		}
+
+		wg.Add(1)
+		go func(file ovf.File, item nfc.FileItem) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := upload(ctx, client, archive, pkg.Manifest, file, item, progress); err != nil {
+				once.Do(func() {
+					firstErr = fmt.Errorf("%s: %s", item.Path, err)
+					cancel()
+				})
+			}
+		}(file, item)
+	}
+
+	wg.Wait()
+
+	if firstErr == nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if firstErr == nil {
+		log.Printf("[INFO] ova upload: finished uploading %d files", len(items))
+	}
+	return firstErr
+}
+
+func upload(ctx context.Context, client *soap.Client, archive Archive, manifest Manifest, file ovf.File, item nfc.FileItem, progress *uploadProgress) error {
+	f, size, err := OpenPackageFile(ctx, archive, manifest, file)
 	if err != nil {
 		return err
 	}
+	defer f.Close()
+
+	// Remote servers don't always report a length, so fall back to the size
+	// the descriptor declared.
+	//
+	// For gzip files that is the compressed size. Their length is only known
+	// once they have been decompressed, and finding it out first would mean
+	// reading them twice or extracting them to local disk, so they are
+	// decompressed as they are sent, with chunked encoding. The streamVmdk
+	// endpoint parses the disk as it arrives, and a stream-optimized VMDK
+	// ends with an end-of-stream marker rather than relying on the request
+	// length.
+	if size < 0 && (file.Compression == nil || *file.Compression != "gzip") {
+		size = item.Size
+	}
 
-	err = lease.Upload(ctx, item, file, soap.Upload{ContentLength: fileInfo.Size()})
+	err = leaseUpload(ctx, client, item, f, soap.Upload{
+		ContentLength: size,
+		Progress:      uploadSink(item, progress, item, f, size),
+	})
+	if err == nil {
+		err = f.Finish()
+	}
+
+	// A checksum or manifest failure surfaces as a read error inside the
+	// upload, so report it directly rather than as an upload failure.
+	if verr := f.Err(); verr != nil {
+		return verr
+	}
 	if err != nil {
 		return fmt.Errorf("Lease upload: %s", err)
 	}
-
 	return nil
 }
+
+// leaseUpload uploads f to a lease item like nfc.Lease.Upload, but reports
+// progress to opts.Progress alone. Lease.Upload always reports to the item
+// too, measured against opts.ContentLength, which makes no sense when the
+// length is unknown.
+func leaseUpload(ctx context.Context, client *soap.Client, item nfc.FileItem, f io.Reader, opts soap.Upload) error {
+	// Non-disk files, such as ISOs, have to be PUT.
+	if item.Create {
+		opts.Method = "PUT"
+		opts.Headers = map[string]string{"Overwrite": "t"}
+	} else {
+		opts.Method = "POST"
+		opts.Type = "application/x-vnd.vmware-streamVmdk"
+	}
+	return client.Upload(ctx, f, item.URL, &opts)
+}
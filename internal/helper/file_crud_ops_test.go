@@ -0,0 +1,167 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+const testNetworkDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1">
+  <NetworkSection>
+    <Info>Networks</Info>
+    <Network name="VM Network"/>
+    <Network name="Management"/>
+  </NetworkSection>
+</Envelope>`
+
+func testEnvelope(t *testing.T, descriptor string) *ovf.Envelope {
+	t.Helper()
+	envelope, err := ovf.Unmarshal(strings.NewReader(descriptor))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return envelope
+}
+
+func TestNetworkMappings(t *testing.T) {
+	envelope := testEnvelope(t, testNetworkDescriptor)
+
+	cases := []struct {
+		name           string
+		mappings       map[string]string
+		defaultNetwork string
+		expected       map[string]string
+	}{
+		{
+			name: "same name",
+			expected: map[string]string{
+				"VM Network": "VM Network",
+				"Management": "Management",
+			},
+		},
+		{
+			name:     "explicit mapping",
+			mappings: map[string]string{"VM Network": "dvportgroup-12"},
+			expected: map[string]string{
+				"VM Network": "dvportgroup-12",
+				"Management": "Management",
+			},
+		},
+		{
+			name:           "default network",
+			mappings:       map[string]string{"Management": "/dc1/network/mgmt"},
+			defaultNetwork: "/dc1/network/workload",
+			expected: map[string]string{
+				"VM Network": "/dc1/network/workload",
+				"Management": "/dc1/network/mgmt",
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		actual, err := NetworkMappings(envelope, tc.mappings, tc.defaultNetwork)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.name, err)
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestNetworkMappings_unknownNetwork(t *testing.T) {
+	envelope := testEnvelope(t, testNetworkDescriptor)
+
+	_, err := NetworkMappings(envelope, map[string]string{"Storage": "storage-pg"}, "")
+	if err == nil {
+		t.Fatal("expected error mapping an undeclared network")
+	}
+}
+
+func TestApplyStorageProfile(t *testing.T) {
+	disk := &types.VirtualDeviceConfigSpec{Device: &types.VirtualDisk{}}
+	nic := &types.VirtualDeviceConfigSpec{Device: &types.VirtualVmxnet3{}}
+	spec := &types.VirtualMachineImportSpec{
+		ConfigSpec: types.VirtualMachineConfigSpec{
+			DeviceChange: []types.BaseVirtualDeviceConfigSpec{disk, nic},
+		},
+	}
+
+	if err := applyStorageProfile(spec, "profile-1"); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if len(spec.ConfigSpec.VmProfile) != 1 {
+		t.Fatalf("expected VM profile to be set, got %v", spec.ConfigSpec.VmProfile)
+	}
+	if len(disk.Profile) != 1 || disk.Profile[0].(*types.VirtualMachineDefinedProfileSpec).ProfileId != "profile-1" {
+		t.Fatalf("expected disk profile to be set, got %v", disk.Profile)
+	}
+	if len(nic.Profile) != 0 {
+		t.Fatalf("expected no profile on non-disk device, got %v", nic.Profile)
+	}
+}
+
+// TestUpload_gzip checks that a gzip file is decompressed as it is uploaded,
+// with chunked encoding since its length isn't known up front.
+func TestUpload_gzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := bytes.Repeat([]byte("stream-optimized disk "), 1000)
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(contents)
+	w.Close()
+	testWriteFiles(t, dir, map[string][]byte{
+		"test.ovf":           []byte("<Envelope/>"),
+		"test-disk1.vmdk.gz": compressed.Bytes(),
+	})
+
+	var received []byte
+	var contentLength int64
+	var transferEncoding []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentLength, transferEncoding = r.ContentLength, r.TransferEncoding
+		received, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	u, err := url.Parse(server.URL + "/nfc/disk-0.vmdk")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	item := nfc.NewFileItem(u, types.OvfFileItem{Path: "test-disk1.vmdk.gz", Size: int64(compressed.Len())})
+	gz := "gzip"
+	file := ovf.File{Href: "test-disk1.vmdk.gz", Size: uint(compressed.Len()), Compression: &gz}
+
+	client := soap.NewClient(u, true)
+	archive := testOpenArchive(t, dir+"/test.ovf")
+	if err := upload(context.Background(), client, archive, nil, file, item, newUploadProgress([]nfc.FileItem{item})); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if !bytes.Equal(received, contents) {
+		t.Fatalf("expected the decompressed contents to be uploaded, got %d bytes", len(received))
+	}
+	if contentLength != -1 || len(transferEncoding) != 1 || transferEncoding[0] != "chunked" {
+		t.Fatalf("expected a chunked upload, got length %d and encoding %q", contentLength, transferEncoding)
+	}
+}
@@ -0,0 +1,140 @@
+package helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// digestLineRegexp matches the "SHA256(name)= <hex>" lines of manifests and
+// of the signature in .cert files.
+var digestLineRegexp = regexp.MustCompile(`^\s*(SHA1|SHA256|SHA512)\((.+)\)\s*=\s*([0-9a-fA-F]+)\s*$`)
+
+// Manifest holds the digests listed in an OVF package's .mf file, keyed by
+// file name.
+type Manifest map[string]*Checksum
+
+// ParseManifest parses the lines of an OVF manifest, which look like
+// "SHA256(disk1.vmdk)= <hex>".
+func ParseManifest(r io.Reader) (Manifest, error) {
+	manifest := Manifest{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		m := digestLineRegexp.FindStringSubmatch(line)
+		if m == nil {
+			return nil, fmt.Errorf("malformed manifest line %q", line)
+		}
+
+		sum, err := hex.DecodeString(m[3])
+		if err != nil {
+			return nil, fmt.Errorf("malformed manifest digest for %s: %s", m[2], err)
+		}
+		manifest[m[2]] = &Checksum{Algorithm: strings.ToLower(m[1]), Sum: sum}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// readMetadata reads one of the optional package metadata files, the one
+// with extension ext, returning nil if the package doesn't have it.
+func readMetadata(ctx context.Context, archive Archive, ext string) ([]byte, error) {
+	var r io.ReadCloser
+	var err error
+	switch a := archive.(type) {
+	case *TapeArchive:
+		r, _, err = a.openMetadata(ctx, ext)
+	case *FileArchive:
+		r, _, err = a.Open(ctx, a.sibling(ext))
+	default:
+		err = fmt.Errorf("unsupported archive %T", archive)
+	}
+	if err != nil {
+		if _, ok := err.(*FileNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	if err := r.Close(); err != nil {
+		return nil, err
+	}
+	return contents, nil
+}
+
+// VerifyDescriptor checks the descriptor contents against the manifest entry
+// for the package's .ovf file.
+func (m Manifest) VerifyDescriptor(contents []byte) error {
+	for name := range m {
+		if strings.EqualFold(path.Ext(name), ".ovf") {
+			return m.Verify(name, bytes.NewReader(contents))
+		}
+	}
+	return fmt.Errorf("manifest has no entry for the ovf descriptor")
+}
+
+// Verify hashes r in full and compares it to the manifest entry for name.
+func (m Manifest) Verify(name string, r io.Reader) error {
+	h, err := m.Hash(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return err
+	}
+	return m.Check(name, h)
+}
+
+// Hash returns a fresh hash of the algorithm the manifest uses for name.
+func (m Manifest) Hash(name string) (hash.Hash, error) {
+	c, ok := m[name]
+	if !ok {
+		return nil, fmt.Errorf("%s is not listed in the manifest", name)
+	}
+	return c.newHash()
+}
+
+// Check compares the digest accumulated in h against the manifest entry for
+// name, returning a *DigestMismatchError if they differ.
+func (m Manifest) Check(name string, h hash.Hash) error {
+	c := m[name]
+	if sum := h.Sum(nil); !bytes.Equal(sum, c.Sum) {
+		return &DigestMismatchError{Name: name, Algorithm: c.Algorithm, Expected: c.Sum, Actual: sum}
+	}
+	return nil
+}
+
+// DigestMismatchError is returned when a file doesn't match the digest the
+// manifest lists for it.
+type DigestMismatchError struct {
+	Name      string
+	Algorithm string
+	Expected  []byte
+	Actual    []byte
+}
+
+// Error implements error for DigestMismatchError.
+func (e *DigestMismatchError) Error() string {
+	return fmt.Sprintf("manifest %s digest mismatch for %s: expected %x, got %x", e.Algorithm, e.Name, e.Expected, e.Actual)
+}
@@ -0,0 +1,83 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	manifest, err := ParseManifest(strings.NewReader(fmt.Sprintf(
+		"SHA256(test.ovf)= %x\nSHA1(test-disk1.vmdk)=%x\nSHA512(test-disk2.vmdk)= %x\n\n",
+		sha256.Sum256([]byte("<Envelope/>")),
+		sha1.Sum([]byte("disk contents")),
+		sha512.Sum512([]byte("more disk contents")),
+	)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := manifest.VerifyDescriptor([]byte("<Envelope/>")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := manifest.Verify("test-disk1.vmdk", strings.NewReader("disk contents")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	err = manifest.Verify("test-disk1.vmdk", strings.NewReader("corrupted"))
+	if _, ok := err.(*DigestMismatchError); !ok {
+		t.Fatalf("expected DigestMismatchError, got %v", err)
+	}
+
+	if err := manifest.Verify("test-disk2.vmdk", strings.NewReader("more disk contents")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := manifest.Verify("test-disk3.vmdk", strings.NewReader("")); err == nil {
+		t.Fatal("expected error verifying a file missing from the manifest")
+	}
+
+	if _, err := ParseManifest(strings.NewReader("MD5(test.ovf)= abcd\n")); err == nil {
+		t.Fatal("expected error parsing an unsupported digest")
+	}
+}
+
+func TestOpenPackageManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	withManifest := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":        testNetworkDescriptor,
+		"test.mf":         fmt.Sprintf("SHA512(test.ovf)= %x\n", sha512.Sum512([]byte(testNetworkDescriptor))),
+		"test-disk1.vmdk": "disk contents",
+	})
+	pkg, err := OpenPackage(context.Background(), withManifest, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, ok := pkg.Manifest["test.ovf"]; !ok {
+		t.Fatalf("expected manifest entry for test.ovf, got %v", pkg.Manifest)
+	}
+
+	os.Remove(withManifest)
+	withoutManifest := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":        testNetworkDescriptor,
+		"test-disk1.vmdk": "disk contents",
+	})
+	pkg, err = OpenPackage(context.Background(), withoutManifest, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if pkg.Manifest != nil {
+		t.Fatalf("expected no manifest, got %v", pkg.Manifest)
+	}
+}
@@ -0,0 +1,104 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+// Package is an OVF package opened for import: its archive, plus the
+// metadata files read and cross-checked up front.
+type Package struct {
+	Archive    Archive
+	Descriptor []byte
+	Envelope   *ovf.Envelope
+
+	// Manifest is nil if the package doesn't ship a .mf file.
+	Manifest Manifest
+
+	// Signature is nil if the package doesn't ship a .cert file.
+	Signature *Signature
+
+	// Checksum is the checksum the OVA still has to match. It is checked
+	// against the bytes that are uploaded, as they are read, so it is nil
+	// for an OVF, whose descriptor is checked when it is opened.
+	Checksum *Checksum
+}
+
+// DescriptorDigest returns the sha256 digest of the descriptor, as
+// "sha256:<hex>". Unlike a checksum of the source, it is always known.
+func (pkg *Package) DescriptorDigest() string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(pkg.Descriptor))
+}
+
+// VerifyChecksum reads the whole OVA and checks it against the package
+// checksum, for when it isn't going to be imported. It does nothing if there
+// is no checksum left to check.
+func (pkg *Package) VerifyChecksum(ctx context.Context) error {
+	t, ok := pkg.Archive.(*TapeArchive)
+	if !ok || pkg.Checksum == nil {
+		return nil
+	}
+	return verifySource(ctx, t.Path, pkg.Checksum)
+}
+
+// OpenPackage reads the descriptor, manifest and certificate of the OVF or
+// OVA at path. The descriptor is verified against the manifest, if present.
+//
+// If checksum is set, it is checked against the file at path. For an OVF
+// that is the descriptor, which is checked here. An OVA is only checked in
+// full once it has been imported, or by VerifyChecksum.
+func OpenPackage(ctx context.Context, path string, checksum *Checksum) (*Package, error) {
+	archive, err := OpenArchive(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{Archive: archive}
+	_, ova := archive.(*TapeArchive)
+	if ova {
+		pkg.Checksum = checksum
+	}
+
+	pkg.Descriptor, err = ReadDescriptor(ctx, pkg.Archive)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading descriptor: %s", err)
+	}
+
+	if checksum != nil && !ova {
+		if err := checksum.verify(path, bytes.NewReader(pkg.Descriptor)); err != nil {
+			return nil, err
+		}
+	}
+
+	pkg.Envelope, err = ovf.Unmarshal(bytes.NewReader(pkg.Descriptor))
+	if err != nil {
+		return nil, fmt.Errorf("failure unmarshalling ovf: %s", err)
+	}
+
+	rawManifest, err := readMetadata(ctx, pkg.Archive, ".mf")
+	if err != nil {
+		return nil, fmt.Errorf("failure reading manifest: %s", err)
+	}
+	if rawManifest == nil {
+		return pkg, nil
+	}
+
+	pkg.Manifest, err = ParseManifest(bytes.NewReader(rawManifest))
+	if err != nil {
+		return nil, fmt.Errorf("failure parsing manifest: %s", err)
+	}
+	if err := pkg.Manifest.VerifyDescriptor(pkg.Descriptor); err != nil {
+		return nil, err
+	}
+
+	pkg.Signature, err = ReadSignature(ctx, pkg.Archive, rawManifest)
+	if err != nil {
+		return nil, fmt.Errorf("failure reading certificate: %s", err)
+	}
+
+	return pkg, nil
+}
@@ -0,0 +1,239 @@
+package helper
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"path"
+	"sync/atomic"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+// PackageFile streams the contents of a file referenced by the descriptor. It
+// reassembles chunked files, decompresses gzip files, and verifies every
+// package file it reads against the manifest.
+type PackageFile struct {
+	io.Reader
+
+	chunks *chunkReader
+	gz     io.Closer
+}
+
+// OpenPackageFile opens the file the descriptor references as file, returning
+// a reader for its uncompressed contents and the length of those contents, or
+// -1 if it can't be determined without reading them. That is always the case
+// for gzip files, since the descriptor only declares their compressed size.
+func OpenPackageFile(ctx context.Context, archive Archive, manifest Manifest, file ovf.File) (*PackageFile, int64, error) {
+	compressed := file.Compression != nil && *file.Compression == "gzip"
+	if file.Compression != nil && !compressed && *file.Compression != "identity" {
+		return nil, 0, fmt.Errorf("%s: unsupported compression %q", file.Href, *file.Compression)
+	}
+
+	size := int64(-1)
+	if !compressed && file.ChunkSize != nil && file.Size > 0 {
+		size = int64(file.Size)
+	}
+
+	chunks := newChunkReader(ctx, archive, manifest, file)
+	f := &PackageFile{Reader: chunks, chunks: chunks}
+
+	if !compressed && size < 0 && file.ChunkSize == nil {
+		// A single uncompressed file: its size is whatever the archive says.
+		if err := chunks.next(); err != nil {
+			return nil, 0, err
+		}
+		size = chunks.size
+	}
+
+	if compressed {
+		gz, err := gzip.NewReader(chunks)
+		if err != nil {
+			chunks.Close()
+			return nil, 0, fmt.Errorf("%s: %s", file.Href, err)
+		}
+		f.Reader, f.gz = gz, gz
+	}
+
+	return f, size, nil
+}
+
+// Finish reads whatever is left of the file so the last package file gets
+// verified even when the consumer stopped reading at the expected length.
+func (f *PackageFile) Finish() error {
+	if _, err := io.Copy(ioutil.Discard, f.Reader); err != nil {
+		return err
+	}
+	return f.chunks.err
+}
+
+// Err returns the first error hit while reading or verifying the underlying
+// package files. It tells verification failures apart from upload failures,
+// which wrap whatever the reader returned.
+func (f *PackageFile) Err() error {
+	return f.chunks.err
+}
+
+// Position returns how many bytes of the package files backing the file
+// have been read so far. For a gzip file that is how much of its compressed
+// size has been uploaded. It is safe to call while the file is being read.
+func (f *PackageFile) Position() int64 {
+	return atomic.LoadInt64(&f.chunks.pos)
+}
+
+// Close closes the file. It doesn't read what's left, so closing after a
+// failure or cancellation returns straight away.
+func (f *PackageFile) Close() error {
+	if f.gz != nil {
+		f.gz.Close()
+	}
+	return f.chunks.Close()
+}
+
+// chunkReader concatenates the package files backing a descriptor file, which
+// is just the file itself unless it is chunked. Chunks are named after the
+// file with a nine digit sequence number appended, per the OVF spec.
+type chunkReader struct {
+	ctx      context.Context
+	archive  Archive
+	manifest Manifest
+	file     ovf.File
+
+	// pos counts the bytes read across all chunks. It is only accessed
+	// atomically.
+	pos int64
+
+	index   int
+	current io.ReadCloser
+	name    string
+	size    int64
+	h       hash.Hash
+
+	err error
+}
+
+func newChunkReader(ctx context.Context, archive Archive, manifest Manifest, file ovf.File) *chunkReader {
+	return &chunkReader{ctx: ctx, archive: archive, manifest: manifest, file: file}
+}
+
+// count returns how many chunks there are, or -1 if the total size isn't
+// declared and chunks have to be read until one is missing.
+func (c *chunkReader) count() int {
+	if c.file.ChunkSize == nil {
+		return 1
+	}
+	if c.file.Size == 0 || *c.file.ChunkSize <= 0 {
+		return -1
+	}
+	return int((int64(c.file.Size) + int64(*c.file.ChunkSize) - 1) / int64(*c.file.ChunkSize))
+}
+
+func (c *chunkReader) chunkName(i int) string {
+	if c.file.ChunkSize == nil {
+		return c.file.Href
+	}
+	return fmt.Sprintf("%s.%09d", c.file.Href, i)
+}
+
+// next opens the next chunk, returning io.EOF when there are none left.
+func (c *chunkReader) next() error {
+	if count := c.count(); count >= 0 && c.index >= count {
+		return io.EOF
+	}
+
+	name := c.chunkName(c.index)
+	if s, ok := c.archive.(*tapeStream); ok && c.count() < 0 && c.index > 0 {
+		// Looking past the last chunk of a stream would skip the files
+		// after it, so stop as soon as the chunks run out.
+		next, err := s.nextName()
+		if err != nil {
+			return err
+		}
+		if next != name && path.Base(next) != name {
+			return io.EOF
+		}
+	}
+	r, size, err := c.archive.Open(c.ctx, name)
+	if err != nil {
+		if _, ok := err.(*FileNotFoundError); ok && c.count() < 0 && c.index > 0 {
+			return io.EOF
+		}
+		return err
+	}
+
+	c.h = nil
+	if c.manifest != nil {
+		if c.h, err = c.manifest.Hash(name); err != nil {
+			r.Close()
+			return err
+		}
+	}
+
+	c.index++
+	c.current, c.name, c.size = r, name, size
+	return nil
+}
+
+// finish closes the current chunk and checks it against the manifest.
+func (c *chunkReader) finish() error {
+	r := c.current
+	c.current = nil
+	if err := r.Close(); err != nil {
+		return err
+	}
+	if c.h != nil {
+		return c.manifest.Check(c.name, c.h)
+	}
+	return nil
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	for {
+		if c.current == nil {
+			if err := c.next(); err != nil {
+				if err != io.EOF {
+					c.err = err
+				}
+				return 0, err
+			}
+		}
+
+		n, err := c.current.Read(p)
+		atomic.AddInt64(&c.pos, int64(n))
+		if c.h != nil {
+			c.h.Write(p[:n])
+		}
+
+		if err == io.EOF {
+			if err := c.finish(); err != nil {
+				c.err = err
+				return n, err
+			}
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		if err != nil {
+			c.err = err
+		}
+		return n, err
+	}
+}
+
+// Close closes the chunk being read, if any.
+func (c *chunkReader) Close() error {
+	if c.current == nil {
+		return nil
+	}
+	r := c.current
+	c.current = nil
+	return r.Close()
+}
@@ -0,0 +1,156 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+func testWriteFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, body := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), body, 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+}
+
+func testReadPackageFile(t *testing.T, archive Archive, manifest Manifest, file ovf.File) ([]byte, int64, error) {
+	t.Helper()
+	f, size, err := OpenPackageFile(context.Background(), archive, manifest, file)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+
+	body, err := ioutil.ReadAll(f)
+	if err == nil {
+		err = f.Finish()
+	}
+	return body, size, err
+}
+
+func TestOpenPackageFile_chunkedGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Random contents don't compress, so the gzip file spans several chunks.
+	contents := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(contents)
+
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(contents)
+	w.Close()
+
+	chunkSize := 100
+	files := map[string][]byte{"test.ovf": []byte("<Envelope/>")}
+	mf := ""
+	for i := 0; i*chunkSize < compressed.Len(); i++ {
+		end := (i + 1) * chunkSize
+		if end > compressed.Len() {
+			end = compressed.Len()
+		}
+		name := fmt.Sprintf("test-disk1.vmdk.gz.%09d", i)
+		files[name] = compressed.Bytes()[i*chunkSize : end]
+		mf += fmt.Sprintf("SHA256(%s)= %x\n", name, sha256.Sum256(files[name]))
+	}
+	testWriteFiles(t, dir, files)
+
+	manifest, err := ParseManifest(bytes.NewReader([]byte(mf)))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	gz := "gzip"
+	file := ovf.File{
+		Href:        "test-disk1.vmdk.gz",
+		Size:        uint(compressed.Len()),
+		Compression: &gz,
+		ChunkSize:   &chunkSize,
+	}
+	archive := testOpenArchive(t, filepath.Join(dir, "test.ovf"))
+
+	body, size, err := testReadPackageFile(t, archive, manifest, file)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !bytes.Equal(body, contents) {
+		t.Fatalf("contents were not reassembled correctly")
+	}
+	if size != -1 {
+		t.Fatalf("expected the uncompressed size to be unknown, got %d", size)
+	}
+
+	// Opening the file must not read it ahead of the upload.
+	counting := &countingArchive{Archive: archive}
+	f, _, err := OpenPackageFile(context.Background(), counting, manifest, file)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	f.Close()
+	if counting.opens > 1 {
+		t.Fatalf("expected at most the first chunk to be opened, got %d opens", counting.opens)
+	}
+
+	// Corrupt the last chunk without changing the manifest.
+	last := fmt.Sprintf("test-disk1.vmdk.gz.%09d", len(files)-2)
+	corrupted := append([]byte{}, files[last]...)
+	corrupted[0] ^= 0xff
+	testWriteFiles(t, dir, map[string][]byte{last: corrupted})
+
+	f, _, err = OpenPackageFile(context.Background(), archive, manifest, ovf.File{Href: file.Href, Size: file.Size, ChunkSize: &chunkSize})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	ioutil.ReadAll(f)
+	if _, ok := f.Err().(*DigestMismatchError); !ok {
+		t.Fatalf("expected DigestMismatchError, got %v", f.Err())
+	}
+}
+
+// countingArchive counts the files opened through it.
+type countingArchive struct {
+	Archive
+	opens int
+}
+
+func (a *countingArchive) Open(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	a.opens++
+	return a.Archive.Open(ctx, name)
+}
+
+func TestOpenPackageFile_plain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":        "<Envelope/>",
+		"test-disk1.vmdk": "disk contents",
+	})
+
+	body, size, err := testReadPackageFile(t, testOpenArchive(t, p), nil, ovf.File{Href: "test-disk1.vmdk"})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(body) != "disk contents" || size != int64(len(body)) {
+		t.Fatalf("bad file: %q (%d bytes)", body, size)
+	}
+}
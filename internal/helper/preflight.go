@@ -0,0 +1,99 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// PlacementOptions are the import options that vCenter's pre-flight checks
+// depend on.
+type PlacementOptions struct {
+	DeploymentOption string
+	DiskProvisioning string
+
+	// Host is checked instead of a host the resource pool runs on, when the
+	// import targets a specific host.
+	Host *object.HostSystem
+}
+
+// ValidatePlacement has vCenter parse the descriptor and check it against a
+// host the resource pool runs on, so that bad packages and incompatible
+// hosts are caught before an upload begins. Warnings are logged, and every
+// error is returned. Cancelling ctx aborts the checks.
+func ValidatePlacement(ctx context.Context, client *govmomi.Client, descriptor []byte, pool *object.ResourcePool, opts PlacementOptions) error {
+	manager := ovf.NewManager(client.Client)
+	common := types.OvfManagerCommonParams{DeploymentOption: opts.DeploymentOption}
+
+	parsed, err := manager.ParseDescriptor(ctx, string(descriptor), types.OvfParseDescriptorParams{OvfManagerCommonParams: common})
+	if err != nil {
+		return fmt.Errorf("failure parsing descriptor: %s", err)
+	}
+	logFaults("descriptor", parsed.Warning)
+	problems := faultMessages("descriptor", parsed.Error)
+
+	var host types.ManagedObjectReference
+	if opts.Host != nil {
+		host = opts.Host.Reference()
+	} else if host, err = ResourcePoolHost(client, pool.Reference()); err != nil {
+		return fmt.Errorf("failure finding a host for resource pool %s: %s", pool.Reference().Value, err)
+	}
+
+	validated, err := manager.ValidateHost(ctx, string(descriptor), host, types.OvfValidateHostParams{OvfManagerCommonParams: common})
+	if err != nil {
+		return fmt.Errorf("failure validating host %s: %s", host.Value, err)
+	}
+	subject := "host " + host.Value
+	logFaults(subject, validated.Warning)
+	problems = append(problems, faultMessages(subject, validated.Error)...)
+
+	if opts.DiskProvisioning != "" && len(validated.SupportedDiskProvisioning) > 0 {
+		supported := false
+		for _, p := range validated.SupportedDiskProvisioning {
+			supported = supported || p == opts.DiskProvisioning
+		}
+		if !supported {
+			problems = append(problems, fmt.Sprintf("%s: disk provisioning %q must be one of %q", subject, opts.DiskProvisioning, validated.SupportedDiskProvisioning))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("ovf validation failed:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// faultMessages describes each fault, prefixed with what it is about.
+func faultMessages(subject string, faults []types.LocalizedMethodFault) []string {
+	var messages []string
+	for _, f := range faults {
+		messages = append(messages, fmt.Sprintf("%s: %s", subject, faultMessage(f)))
+	}
+	return messages
+}
+
+// logFaults logs faults that vCenter reports as warnings.
+func logFaults(subject string, faults []types.LocalizedMethodFault) {
+	for _, message := range faultMessages(subject, faults) {
+		log.Printf("[WARN] %s", message)
+	}
+}
+
+// faultMessage returns the localized message of a fault, falling back to the
+// fault's type when vCenter didn't send one.
+func faultMessage(f types.LocalizedMethodFault) string {
+	if f.LocalizedMessage != "" {
+		return f.LocalizedMessage
+	}
+	if f.Fault == nil {
+		return "unknown fault"
+	}
+	return reflect.TypeOf(f.Fault).Elem().Name()
+}
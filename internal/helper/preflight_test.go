@@ -0,0 +1,25 @@
+package helper
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestFaultMessages(t *testing.T) {
+	faults := []types.LocalizedMethodFault{
+		{LocalizedMessage: "Unsupported hardware family 'vmx-15'."},
+		{Fault: &types.OvfUnsupportedDiskProvisioning{}},
+		{},
+	}
+
+	expected := []string{
+		"host host-1: Unsupported hardware family 'vmx-15'.",
+		"host host-1: OvfUnsupportedDiskProvisioning",
+		"host host-1: unknown fault",
+	}
+	if actual := faultMessages("host host-1", faults); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+}
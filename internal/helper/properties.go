@@ -0,0 +1,171 @@
+package helper
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+var (
+	qualifierRegexp = regexp.MustCompile(`(\w+)\(([^)]*)\)`)
+	valueMapRegexp  = regexp.MustCompile(`ValueMap\{([^}]*)\}`)
+)
+
+// ProductProperties returns every ProductSection property declared in the
+// envelope, keyed by its fully qualified ID (class.key.instance).
+func ProductProperties(envelope *ovf.Envelope) map[string]ovf.Property {
+	var sections []ovf.ProductSection
+	if envelope.Product != nil {
+		sections = append(sections, *envelope.Product)
+	}
+	if envelope.VirtualSystem != nil {
+		sections = append(sections, envelope.VirtualSystem.Product...)
+	}
+
+	properties := map[string]ovf.Property{}
+	for _, section := range sections {
+		for _, p := range section.Property {
+			properties[propertyID(section, p)] = p
+		}
+	}
+	return properties
+}
+
+func propertyID(section ovf.ProductSection, p ovf.Property) string {
+	id := p.Key
+	if section.Class != nil && *section.Class != "" {
+		id = *section.Class + "." + id
+	}
+	if section.Instance != nil && *section.Instance != "" {
+		id = id + "." + *section.Instance
+	}
+	return id
+}
+
+// ValidateProperties checks the supplied property values against the
+// properties declared in the envelope, returning every problem found.
+func ValidateProperties(envelope *ovf.Envelope, values map[string]string) error {
+	declared := ProductProperties(envelope)
+
+	var problems []string
+	for key, value := range values {
+		p, ok := declared[key]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("property %q is not declared in the ovf", key))
+			continue
+		}
+		if p.UserConfigurable == nil || !*p.UserConfigurable {
+			problems = append(problems, fmt.Sprintf("property %q is not user configurable", key))
+			continue
+		}
+		if err := validatePropertyValue(p, value); err != nil {
+			problems = append(problems, fmt.Sprintf("property %q: %s", key, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("invalid properties:\n\t%s", strings.Join(problems, "\n\t"))
+	}
+	return nil
+}
+
+// PropertyMapping converts property values into the form expected by
+// OvfCreateImportSpecParams.
+func PropertyMapping(values map[string]string) []types.KeyValue {
+	var mapping []types.KeyValue
+	for key, value := range values {
+		mapping = append(mapping, types.KeyValue{Key: key, Value: value})
+	}
+	sort.Slice(mapping, func(i, j int) bool { return mapping[i].Key < mapping[j].Key })
+	return mapping
+}
+
+func validatePropertyValue(p ovf.Property, value string) error {
+	if err := validatePropertyType(p.Type, value); err != nil {
+		return err
+	}
+
+	if p.Qualifiers == nil {
+		return nil
+	}
+
+	if m := valueMapRegexp.FindStringSubmatch(*p.Qualifiers); m != nil {
+		var allowed []string
+		for _, v := range strings.Split(m[1], ",") {
+			allowed = append(allowed, strings.Trim(strings.TrimSpace(v), `"`))
+		}
+		found := false
+		for _, v := range allowed {
+			if v == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value %q must be one of %q", value, allowed)
+		}
+	}
+
+	for _, m := range qualifierRegexp.FindAllStringSubmatch(*p.Qualifiers, -1) {
+		name, arg := m[1], strings.TrimSpace(m[2])
+		switch name {
+		case "MinLen", "MaxLen":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return fmt.Errorf("bad %s qualifier %q", name, arg)
+			}
+			if name == "MinLen" && len(value) < n {
+				return fmt.Errorf("value must be at least %d characters", n)
+			}
+			if name == "MaxLen" && len(value) > n {
+				return fmt.Errorf("value must be at most %d characters", n)
+			}
+		case "MinValue", "MaxValue":
+			limit, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				return fmt.Errorf("bad %s qualifier %q", name, arg)
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("value %q is not numeric", value)
+			}
+			if name == "MinValue" && v < limit {
+				return fmt.Errorf("value must be at least %s", arg)
+			}
+			if name == "MaxValue" && v > limit {
+				return fmt.Errorf("value must be at most %s", arg)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validatePropertyType(propertyType, value string) error {
+	var err error
+	switch propertyType {
+	case "boolean":
+		_, err = strconv.ParseBool(strings.ToLower(value))
+	case "uint8", "uint16", "uint32", "uint64":
+		_, err = strconv.ParseUint(value, 10, bitSize(propertyType, "uint"))
+	case "sint8", "sint16", "sint32", "sint64":
+		_, err = strconv.ParseInt(value, 10, bitSize(propertyType, "sint"))
+	case "real32", "real64":
+		_, err = strconv.ParseFloat(value, bitSize(propertyType, "real"))
+	}
+	if err != nil {
+		return fmt.Errorf("value %q is not a valid %s", value, propertyType)
+	}
+	return nil
+}
+
+func bitSize(propertyType, prefix string) int {
+	n, _ := strconv.Atoi(strings.TrimPrefix(propertyType, prefix))
+	return n
+}
@@ -0,0 +1,65 @@
+package helper
+
+import (
+	"testing"
+)
+
+const testPropertyDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <VirtualSystem ovf:id="appliance">
+    <Info>Appliance</Info>
+    <ProductSection ovf:class="vami" ovf:instance="appliance">
+      <Info>Networking</Info>
+      <Property ovf:key="ip0" ovf:type="string" ovf:userConfigurable="true"/>
+    </ProductSection>
+    <ProductSection>
+      <Info>Settings</Info>
+      <Property ovf:key="hostname" ovf:type="string" ovf:qualifiers="MinLen(1),MaxLen(8)" ovf:userConfigurable="true"/>
+      <Property ovf:key="mode" ovf:type="string" ovf:qualifiers="ValueMap{&quot;dhcp&quot;,&quot;static&quot;}" ovf:userConfigurable="true"/>
+      <Property ovf:key="port" ovf:type="uint16" ovf:qualifiers="MinValue(1024)" ovf:userConfigurable="true"/>
+      <Property ovf:key="debug" ovf:type="boolean" ovf:userConfigurable="true"/>
+      <Property ovf:key="build" ovf:type="string" ovf:value="1234"/>
+    </ProductSection>
+  </VirtualSystem>
+</Envelope>`
+
+func TestProductProperties(t *testing.T) {
+	properties := ProductProperties(testEnvelope(t, testPropertyDescriptor))
+
+	for _, id := range []string{"vami.ip0.appliance", "hostname", "mode", "port", "debug", "build"} {
+		if _, ok := properties[id]; !ok {
+			t.Fatalf("expected property %q in %v", id, properties)
+		}
+	}
+}
+
+func TestValidateProperties(t *testing.T) {
+	envelope := testEnvelope(t, testPropertyDescriptor)
+
+	valid := map[string]string{
+		"vami.ip0.appliance": "10.0.0.10",
+		"hostname":           "appl",
+		"mode":               "static",
+		"port":               "8443",
+		"debug":              "True",
+	}
+	if err := ValidateProperties(envelope, valid); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	invalid := []map[string]string{
+		{"unknown": "x"},
+		{"build": "5678"},
+		{"hostname": ""},
+		{"hostname": "much-too-long"},
+		{"mode": "manual"},
+		{"port": "80"},
+		{"port": "70000"},
+		{"debug": "maybe"},
+	}
+	for _, values := range invalid {
+		if err := ValidateProperties(envelope, values); err == nil {
+			t.Fatalf("expected error validating %v", values)
+		}
+	}
+}
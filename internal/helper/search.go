@@ -8,6 +8,8 @@ import (
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/find"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/property"
+	"github.com/vmware/govmomi/vim25/mo"
 	"github.com/vmware/govmomi/vim25/types"
 )
 
@@ -46,17 +48,240 @@ func Datacenter(client *govmomi.Client, path string) (*object.Datacenter, error)
 	return obj, nil
 }
 
-func Network(client *govmomi.Client, dc *object.Datacenter, networkPath string) (object.NetworkReference, error) {
+// ParentDatacenter walks up the inventory from obj to the datacenter that
+// holds it.
+func ParentDatacenter(client *govmomi.Client, obj object.Reference) (*object.Datacenter, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+	ref := obj.Reference()
+	for ref.Type != "Datacenter" {
+		var entity mo.ManagedEntity
+		if err := pc.RetrieveOne(ctx, ref, []string{"parent"}, &entity); err != nil {
+			return nil, err
+		}
+		if entity.Parent == nil {
+			return nil, fmt.Errorf("%s is not in a datacenter", obj.Reference().Value)
+		}
+		ref = *entity.Parent
+	}
+
 	finder := find.NewFinder(client.Client, false)
-	finder.SetDatacenter(dc)
+	dc, err := finder.ObjectReference(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+	return dc.(*object.Datacenter), nil
+}
+
+// HostResourcePool returns the root resource pool of the cluster or
+// standalone host that host belongs to.
+func HostResourcePool(client *govmomi.Client, host types.ManagedObjectReference) (*types.ManagedObjectReference, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+	var h mo.HostSystem
+	if err := pc.RetrieveOne(ctx, host, []string{"parent"}, &h); err != nil {
+		return nil, err
+	}
+	if h.Parent == nil {
+		return nil, fmt.Errorf("host %s has no compute resource", host.Value)
+	}
+
+	var cr mo.ComputeResource
+	if err := pc.RetrieveOne(ctx, *h.Parent, []string{"resourcePool"}, &cr); err != nil {
+		return nil, err
+	}
+	if cr.ResourcePool == nil {
+		return nil, fmt.Errorf("compute resource %s has no resource pool", h.Parent.Value)
+	}
+	return cr.ResourcePool, nil
+}
 
+// HostComputeResource returns the cluster or standalone compute resource a
+// host belongs to.
+func HostComputeResource(client *govmomi.Client, host types.ManagedObjectReference) (types.ManagedObjectReference, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
 	defer cancel()
 
-	obj, err := finder.Network(ctx, networkPath)
+	pc := property.DefaultCollector(client.Client)
+	var h mo.HostSystem
+	if err := pc.RetrieveOne(ctx, host, []string{"parent"}, &h); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if h.Parent == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("host %s has no compute resource", host.Value)
+	}
+	return *h.Parent, nil
+}
+
+// ResourcePoolOwner returns the cluster or standalone compute resource that
+// owns a resource pool.
+func ResourcePoolOwner(client *govmomi.Client, pool types.ManagedObjectReference) (types.ManagedObjectReference, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+	var p mo.ResourcePool
+	if err := pc.RetrieveOne(ctx, pool, []string{"owner"}, &p); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	return p.Owner, nil
+}
+
+// ResourcePoolHost returns a host that can take new VMs, connected and out of
+// maintenance mode, from the cluster or standalone host that owns a resource
+// pool.
+func ResourcePoolHost(client *govmomi.Client, pool types.ManagedObjectReference) (types.ManagedObjectReference, error) {
+	owner, err := ResourcePoolOwner(client, pool)
+	if err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+	var cr mo.ComputeResource
+	if err := pc.RetrieveOne(ctx, owner, []string{"host"}, &cr); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if len(cr.Host) == 0 {
+		return types.ManagedObjectReference{}, fmt.Errorf("compute resource %s has no hosts", owner.Value)
+	}
+
+	var hosts []mo.HostSystem
+	if err := pc.Retrieve(ctx, cr.Host, []string{"runtime"}, &hosts); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	host, ok := usableHost(cr.Host, hosts)
+	if !ok {
+		return types.ManagedObjectReference{}, fmt.Errorf("compute resource %s has no connected hosts out of maintenance mode", owner.Value)
+	}
+	return host, nil
+}
+
+// usableHost returns the first of refs whose runtime state in hosts says it is
+// connected and not in maintenance mode.
+func usableHost(refs []types.ManagedObjectReference, hosts []mo.HostSystem) (types.ManagedObjectReference, bool) {
+	runtime := map[types.ManagedObjectReference]types.HostRuntimeInfo{}
+	for _, h := range hosts {
+		runtime[h.Reference()] = h.Runtime
+	}
+	for _, ref := range refs {
+		r, ok := runtime[ref]
+		if ok && r.ConnectionState == types.HostSystemConnectionStateConnected && !r.InMaintenanceMode {
+			return ref, true
+		}
+	}
+	return types.ManagedObjectReference{}, false
+}
+
+// networkTypes are the managed object types a network ID can refer to. Port
+// groups come first, since looking one up as a plain Network also succeeds
+// but loses its type.
+var networkTypes = []string{"DistributedVirtualPortgroup", "Network", "OpaqueNetwork"}
+
+// fromIDOrPath looks v up as the ID of an object of one of resourceTypes,
+// falling back to byPath only when there is no such object. IDs don't have a
+// fixed format: ESXi's root resource pool is "ha-root-pool", for one.
+func fromIDOrPath(client *govmomi.Client, v string, resourceTypes []string, byPath func() (object.Reference, error)) (object.Reference, error) {
+	for _, resourceType := range resourceTypes {
+		obj, err := FromID(client, resourceType, v)
+		if err == nil {
+			return obj, nil
+		}
+		if !IsManagedObjectNotFoundError(err) {
+			return nil, err
+		}
+	}
+	return byPath()
+}
+
+// NetworkFromPathOrID finds a network by its managed object ID, or by its
+// inventory path if no network has that ID.
+func NetworkFromPathOrID(client *govmomi.Client, dc *object.Datacenter, v string) (object.NetworkReference, error) {
+	obj, err := fromIDOrPath(client, v, networkTypes, func() (object.Reference, error) {
+		finder := find.NewFinder(client.Client, false)
+		finder.SetDatacenter(dc)
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+		defer cancel()
+
+		return finder.Network(ctx, v)
+	})
 	if err != nil {
 		return nil, fmt.Errorf("Finding network: %s", err)
 	}
+	return obj.(object.NetworkReference), nil
+}
 
-	return obj, nil
+// ResourcePoolFromPathOrID finds a resource pool by its managed object ID, or
+// by its inventory path if no pool has that ID. Relative paths are looked up
+// in dc.
+func ResourcePoolFromPathOrID(client *govmomi.Client, dc *object.Datacenter, v string) (*object.ResourcePool, error) {
+	obj, err := fromIDOrPath(client, v, []string{"ResourcePool"}, func() (object.Reference, error) {
+		finder := find.NewFinder(client.Client, false)
+		finder.SetDatacenter(dc)
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+		defer cancel()
+
+		return finder.ResourcePool(ctx, v)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Finding resource pool: %s", err)
+	}
+	return obj.(*object.ResourcePool), nil
+}
+
+// DatastoreFromPathOrID finds a datastore by its managed object ID, or by its
+// inventory path if no datastore has that ID. Relative paths are looked up in
+// dc.
+func DatastoreFromPathOrID(client *govmomi.Client, dc *object.Datacenter, v string) (*object.Datastore, error) {
+	obj, err := fromIDOrPath(client, v, []string{"Datastore"}, func() (object.Reference, error) {
+		finder := find.NewFinder(client.Client, false)
+		finder.SetDatacenter(dc)
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+		defer cancel()
+
+		return finder.Datastore(ctx, v)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Finding datastore: %s", err)
+	}
+	return obj.(*object.Datastore), nil
+}
+
+// ClusterResourcePool returns the root resource pool of a cluster.
+func ClusterResourcePool(client *govmomi.Client, id string) (*object.ResourcePool, error) {
+	obj, err := FromID(client, "ClusterComputeResource", id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	return obj.(*object.ClusterComputeResource).ResourcePool(ctx)
+}
+
+// DatastoreCluster returns the ID of the datastore cluster a datastore
+// belongs to, or an empty string if it isn't in one.
+func DatastoreCluster(client *govmomi.Client, ds types.ManagedObjectReference) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	pc := property.DefaultCollector(client.Client)
+	var d mo.Datastore
+	if err := pc.RetrieveOne(ctx, ds, []string{"parent"}, &d); err != nil {
+		return "", err
+	}
+	if d.Parent == nil || d.Parent.Type != "StoragePod" {
+		return "", nil
+	}
+	return d.Parent.Value, nil
 }
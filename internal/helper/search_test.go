@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestUsableHost(t *testing.T) {
+	host := func(id string, state types.HostSystemConnectionState, maintenance bool) mo.HostSystem {
+		var h mo.HostSystem
+		h.Self = types.ManagedObjectReference{Type: "HostSystem", Value: id}
+		h.Runtime = types.HostRuntimeInfo{ConnectionState: state, InMaintenanceMode: maintenance}
+		return h
+	}
+	hosts := []mo.HostSystem{
+		host("host-1", types.HostSystemConnectionStateDisconnected, false),
+		host("host-2", types.HostSystemConnectionStateConnected, true),
+		host("host-3", types.HostSystemConnectionStateConnected, false),
+	}
+	var refs []types.ManagedObjectReference
+	for _, h := range hosts {
+		refs = append(refs, h.Self)
+	}
+
+	ref, ok := usableHost(refs, hosts)
+	if !ok || ref.Value != "host-3" {
+		t.Fatalf("expected host-3, got %v (ok: %t)", ref, ok)
+	}
+
+	if ref, ok := usableHost(refs[:2], hosts); ok {
+		t.Fatalf("expected no usable host, got %v", ref)
+	}
+}
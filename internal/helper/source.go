@@ -0,0 +1,165 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Checksum is the expected digest of an OVA or OVF source file.
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseChecksum parses a checksum of the form "sha256:<hex>", "sha512:<hex>"
+// or "sha1:<hex>". A bare hex digest is accepted when its length identifies the
+// algorithm.
+func ParseChecksum(s string) (*Checksum, error) {
+	algorithm, digest := "", s
+	if i := strings.Index(s, ":"); i >= 0 {
+		algorithm, digest = strings.ToLower(s[:i]), s[i+1:]
+	}
+
+	sum, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("checksum %q is not hex encoded", s)
+	}
+
+	if algorithm == "" {
+		switch len(sum) {
+		case sha1.Size:
+			algorithm = "sha1"
+		case sha256.Size:
+			algorithm = "sha256"
+		case sha512.Size:
+			algorithm = "sha512"
+		}
+	}
+
+	c := &Checksum{Algorithm: algorithm, Sum: sum}
+	h, err := c.newHash()
+	if err != nil {
+		return nil, err
+	}
+	if h.Size() != len(sum) {
+		return nil, fmt.Errorf("checksum %q is not a valid %s digest", s, algorithm)
+	}
+	return c, nil
+}
+
+func (c *Checksum) newHash() (hash.Hash, error) {
+	switch c.Algorithm {
+	case "sha1":
+		return sha1.New(), nil
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("unsupported checksum algorithm %q, must be sha1, sha256 or sha512", c.Algorithm)
+}
+
+// IsRemote reports whether path is an http(s) URL rather than a local file.
+func IsRemote(path string) bool {
+	u, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+// sourceClient fetches remote packages. A whole-request timeout would cut off
+// the download of large disks, so the transport only bounds connecting and
+// waiting for the server to respond; the caller's context bounds the rest.
+var sourceClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// openSource opens a local file or http(s) URL for streaming, returning its
+// size, or -1 if the server did not report one. Cancelling ctx aborts a
+// remote download.
+func openSource(ctx context.Context, path string) (io.ReadCloser, int64, error) {
+	if IsRemote(path) {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := sourceClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode == http.StatusNotFound {
+			resp.Body.Close()
+			return nil, 0, &FileNotFoundError{path}
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("GET %s: %s", path, resp.Status)
+		}
+		return resp.Body, resp.ContentLength, nil
+	}
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, 0, &FileNotFoundError{path}
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, 0, err
+	}
+	return f, info.Size(), nil
+}
+
+// verifySource reads the file at path once, in full, and compares its digest
+// to checksum. A failed or cancelled read returns straight away.
+func verifySource(ctx context.Context, path string, checksum *Checksum) error {
+	r, _, err := openSource(ctx, path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	return checksum.verify(path, r)
+}
+
+// verify hashes r in full and compares the digest to the checksum. name is
+// what the error calls the contents.
+func (c *Checksum) verify(name string, r io.Reader) error {
+	h, err := c.newHash()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("failure reading %s: %s", name, err)
+	}
+	if sum := h.Sum(nil); !bytes.Equal(sum, c.Sum) {
+		return fmt.Errorf("%s checksum mismatch for %s: expected %x, got %x", c.Algorithm, name, c.Sum, sum)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseChecksum(t *testing.T) {
+	sha1Digest := strings.Repeat("ab", 20)
+	sha256Digest := strings.Repeat("cd", 32)
+	sha512Digest := strings.Repeat("ef", 64)
+
+	for _, tc := range []struct {
+		input     string
+		algorithm string
+	}{
+		{"sha1:" + sha1Digest, "sha1"},
+		{"SHA256:" + sha256Digest, "sha256"},
+		{sha1Digest, "sha1"},
+		{sha256Digest, "sha256"},
+		{"sha512:" + sha512Digest, "sha512"},
+		{sha512Digest, "sha512"},
+	} {
+		c, err := ParseChecksum(tc.input)
+		if err != nil {
+			t.Fatalf("%s: err: %s", tc.input, err)
+		}
+		if c.Algorithm != tc.algorithm {
+			t.Fatalf("%s: expected %s, got %s", tc.input, tc.algorithm, c.Algorithm)
+		}
+	}
+
+	for _, input := range []string{
+		"md5:" + strings.Repeat("ab", 16),
+		"sha256:" + sha1Digest,
+		"sha1:not-hex",
+		"abcd",
+	} {
+		if _, err := ParseChecksum(input); err == nil {
+			t.Fatalf("expected error parsing %q", input)
+		}
+	}
+}
+
+func testServeDir(t *testing.T, dir string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.FileServer(http.Dir(dir)))
+}
+
+func TestRemoteTapeArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeTestOVA(t, dir, map[string]string{
+		"test.ovf":        "<Envelope/>",
+		"test-disk1.vmdk": "disk contents",
+	})
+
+	server := testServeDir(t, dir)
+	defer server.Close()
+
+	archive := testOpenArchive(t, server.URL+"/test.ova")
+	if _, ok := archive.(*TapeArchive); !ok {
+		t.Fatalf("expected TapeArchive, got %T", archive)
+	}
+
+	r, size, err := archive.Open(context.Background(), "test-disk1.vmdk")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(body) != "disk contents" || size != int64(len(body)) {
+		t.Fatalf("bad entry: %q (%d bytes)", body, size)
+	}
+}
+
+func TestOpenPackageChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	descriptor := testNetworkDescriptor
+	p := writeTestOVA(t, dir, map[string]string{"test.ovf": descriptor})
+	if err := ioutil.WriteFile(dir+"/test.ovf", []byte(descriptor), 0644); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	contents, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	server := testServeDir(t, dir)
+	defer server.Close()
+
+	bad, err := ParseChecksum("sha256:" + strings.Repeat("00", 32))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	for path, digest := range map[string][32]byte{
+		server.URL + "/test.ova": sha256.Sum256(contents),
+		server.URL + "/test.ovf": sha256.Sum256([]byte(descriptor)),
+	} {
+		good, err := ParseChecksum(fmt.Sprintf("sha256:%x", digest))
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		pkg, err := OpenPackage(context.Background(), path, good)
+		if err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+		if expected := fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(descriptor))); pkg.DescriptorDigest() != expected {
+			t.Fatalf("%s: expected descriptor digest %s, got %s", path, expected, pkg.DescriptorDigest())
+		}
+		if err := pkg.VerifyChecksum(context.Background()); err != nil {
+			t.Fatalf("%s: err: %s", path, err)
+		}
+
+		// An OVA is only read in full when it is verified.
+		pkg, err = OpenPackage(context.Background(), path, bad)
+		if err == nil {
+			err = pkg.VerifyChecksum(context.Background())
+		}
+		if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Fatalf("%s: expected checksum mismatch, got %v", path, err)
+		}
+	}
+
+	pkg, err := OpenPackage(context.Background(), server.URL+"/test.ova", bad)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := pkg.VerifyChecksum(ctx); err == nil || strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected a cancelled read to fail without verifying, got %v", err)
+	}
+}
+
+func TestRemoteFileArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, body := range map[string]string{
+		"test.ovf":        "<Envelope/>",
+		"test-disk1.vmdk": "disk contents",
+	} {
+		if err := ioutil.WriteFile(dir+"/"+name, []byte(body), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	server := testServeDir(t, dir)
+	defer server.Close()
+
+	archive := testOpenArchive(t, server.URL+"/test.ovf")
+	descriptor, err := ReadDescriptor(context.Background(), archive)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(descriptor) != "<Envelope/>" {
+		t.Fatalf("bad descriptor: %q", descriptor)
+	}
+
+	r, _, err := archive.Open(context.Background(), "test-disk1.vmdk")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	r.Close()
+
+	if _, _, err := archive.Open(context.Background(), "missing.vmdk"); err == nil {
+		t.Fatal("expected error opening missing file")
+	}
+}
+
+func TestOpenPackageWithoutExtension(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := writeTestOVA(t, dir, map[string]string{"test.ovf": testNetworkDescriptor})
+	ova, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Artifact servers hand packages out under URLs that say nothing about
+	// what they are.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "ova":
+			w.Write(ova)
+		case "ovf":
+			w.Write([]byte(testNetworkDescriptor))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for id, expected := range map[string]string{"ova": "*helper.TapeArchive", "ovf": "*helper.FileArchive"} {
+		pkg, err := OpenPackage(context.Background(), server.URL+"/download?id="+id, nil)
+		if err != nil {
+			t.Fatalf("%s: err: %s", id, err)
+		}
+		if actual := fmt.Sprintf("%T", pkg.Archive); actual != expected {
+			t.Fatalf("%s: expected %s, got %s", id, expected, actual)
+		}
+		if string(pkg.Descriptor) != testNetworkDescriptor {
+			t.Fatalf("%s: bad descriptor: %q", id, pkg.Descriptor)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// RecommendCreateDatastore asks Storage DRS which datastore in a datastore
+// cluster a new virtual machine called name should go on. The recommendation
+// only accounts for the virtual machine's home, since the disks aren't known
+// until vCenter has built the import spec, and imported disks follow the
+// home datastore.
+func RecommendCreateDatastore(client *govmomi.Client, podID string, name string, pool *object.ResourcePool, folder *object.Folder) (*object.Datastore, error) {
+	pod := types.ManagedObjectReference{Type: "StoragePod", Value: podID}
+	poolRef := pool.Reference()
+	folderRef := folder.Reference()
+
+	return recommendDatastore(client, types.StoragePlacementSpec{
+		Type:             string(types.StoragePlacementSpecPlacementTypeCreate),
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{StoragePod: &pod},
+		ConfigSpec: &types.VirtualMachineConfigSpec{
+			Name:  name,
+			Files: &types.VirtualMachineFileInfo{},
+		},
+		ResourcePool: &poolRef,
+		Folder:       &folderRef,
+	})
+}
+
+// RecommendRelocateDatastore asks Storage DRS which datastore in a datastore
+// cluster an existing virtual machine should be moved to.
+func RecommendRelocateDatastore(client *govmomi.Client, podID string, vm *object.VirtualMachine) (*object.Datastore, error) {
+	pod := types.ManagedObjectReference{Type: "StoragePod", Value: podID}
+	vmRef := vm.Reference()
+
+	return recommendDatastore(client, types.StoragePlacementSpec{
+		Type:             string(types.StoragePlacementSpecPlacementTypeRelocate),
+		PodSelectionSpec: types.StorageDrsPodSelectionSpec{StoragePod: &pod},
+		Vm:               &vmRef,
+		RelocateSpec:     &types.VirtualMachineRelocateSpec{},
+	})
+}
+
+func recommendDatastore(client *govmomi.Client, spec types.StoragePlacementSpec) (*object.Datastore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	srm := object.NewStorageResourceManager(client.Client)
+	result, err := srm.RecommendDatastores(ctx, spec)
+	if err != nil {
+		return nil, fmt.Errorf("failure getting storage drs recommendations for datastore cluster %s: %s", spec.PodSelectionSpec.StoragePod.Value, err)
+	}
+
+	ref, err := recommendedDatastore(result)
+	if err != nil {
+		return nil, fmt.Errorf("datastore cluster %s: %s", spec.PodSelectionSpec.StoragePod.Value, err)
+	}
+	return object.NewDatastore(client.Client, ref), nil
+}
+
+// recommendedDatastore picks the destination of the first storage placement
+// in the highest rated recommendation.
+func recommendedDatastore(result *types.StoragePlacementResult) (types.ManagedObjectReference, error) {
+	if result == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("no storage drs recommendations")
+	}
+
+	var best *types.ClusterRecommendation
+	for i, r := range result.Recommendations {
+		if best == nil || r.Rating > best.Rating {
+			best = &result.Recommendations[i]
+		}
+	}
+	if best == nil {
+		var faults []types.LocalizedMethodFault
+		if result.DrsFault != nil {
+			for _, f := range result.DrsFault.FaultsByVm {
+				faults = append(faults, f.GetClusterDrsFaultsFaultsByVm().Fault...)
+			}
+		}
+		if len(faults) > 0 {
+			return types.ManagedObjectReference{}, fmt.Errorf("no storage drs recommendations:\n\t%s", strings.Join(faultMessages("storage drs", faults), "\n\t"))
+		}
+		return types.ManagedObjectReference{}, fmt.Errorf("no storage drs recommendations")
+	}
+
+	for _, action := range best.Action {
+		if placement, ok := action.(*types.StoragePlacementAction); ok {
+			return placement.Destination, nil
+		}
+	}
+	return types.ManagedObjectReference{}, fmt.Errorf("storage drs recommendation %s has no placement", best.Key)
+}
@@ -0,0 +1,43 @@
+package helper
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+func TestRecommendedDatastore(t *testing.T) {
+	placement := func(ds string) types.BaseClusterAction {
+		return &types.StoragePlacementAction{Destination: types.ManagedObjectReference{Type: "Datastore", Value: ds}}
+	}
+
+	result := &types.StoragePlacementResult{
+		Recommendations: []types.ClusterRecommendation{
+			{Key: "1", Rating: 2, Action: []types.BaseClusterAction{placement("datastore-1")}},
+			{Key: "2", Rating: 5, Action: []types.BaseClusterAction{&types.ClusterAction{}, placement("datastore-2")}},
+		},
+	}
+	ref, err := recommendedDatastore(result)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if ref.Value != "datastore-2" {
+		t.Fatalf("expected the highest rated recommendation, got %s", ref.Value)
+	}
+
+	result = &types.StoragePlacementResult{
+		DrsFault: &types.ClusterDrsFaults{
+			FaultsByVm: []types.BaseClusterDrsFaultsFaultsByVm{
+				&types.ClusterDrsFaultsFaultsByVm{Fault: []types.LocalizedMethodFault{{LocalizedMessage: "Insufficient disk space."}}},
+			},
+		},
+	}
+	if _, err := recommendedDatastore(result); err == nil || !strings.Contains(err.Error(), "Insufficient disk space.") {
+		t.Fatalf("expected the drs fault in the error, got %v", err)
+	}
+
+	if _, err := recommendedDatastore(&types.StoragePlacementResult{}); err == nil {
+		t.Fatal("expected no recommendations to fail")
+	}
+}
@@ -0,0 +1,79 @@
+package helper
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/vic/pkg/vsphere/tags"
+)
+
+// adapted from tf vsphere provider internals
+
+// tagTypeVirtualMachine is the CIS object type of virtual machines and
+// templates.
+const tagTypeVirtualMachine = "VirtualMachine"
+
+// IsVirtualCenter checks whether client is connected to vCenter rather than
+// a standalone ESXi host.
+func IsVirtualCenter(client *govmomi.Client) bool {
+	return client.ServiceContent.About.ApiType == "VirtualCenter"
+}
+
+// TagsSupported checks whether the endpoint has the CIS REST API used for
+// tags, which arrived in vCenter 6.0.
+func TagsSupported(client *govmomi.Client) bool {
+	if !IsVirtualCenter(client) {
+		return false
+	}
+	major, err := strconv.Atoi(strings.SplitN(client.ServiceContent.About.Version, ".", 2)[0])
+	return err == nil && major >= 6
+}
+
+// ReadTags lists the IDs of the tags attached to a virtual machine.
+func ReadTags(client *tags.RestClient, vm *object.VirtualMachine) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+	return client.ListAttachedTags(ctx, vm.Reference().Value, tagTypeVirtualMachine)
+}
+
+// ApplyTags attaches the tags in new but not old to a virtual machine, and
+// detaches the ones in old but not new.
+func ApplyTags(client *tags.RestClient, vm *object.VirtualMachine, old, new []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	id := vm.Reference().Value
+	for _, tag := range missingFrom(old, new) {
+		log.Printf("[DEBUG] Detaching tag %q from virtual machine %q", tag, id)
+		if err := client.DetachTagFromObject(ctx, tag, id, tagTypeVirtualMachine); err != nil {
+			return err
+		}
+	}
+	for _, tag := range missingFrom(new, old) {
+		log.Printf("[DEBUG] Attaching tag %q to virtual machine %q", tag, id)
+		if err := client.AttachTagToObject(ctx, tag, id, tagTypeVirtualMachine); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// missingFrom returns the elements of a that aren't in b.
+func missingFrom(a, b []string) []string {
+	in := map[string]bool{}
+	for _, v := range b {
+		in[v] = true
+	}
+
+	var missing []string
+	for _, v := range a {
+		if !in[v] {
+			missing = append(missing, v)
+		}
+	}
+	return missing
+}
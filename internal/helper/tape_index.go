@@ -0,0 +1,102 @@
+package helper
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// tapeIndex gives random access to the entries of a local OVA, so several
+// of them can be uploaded at once. Only the tar headers are read to build it;
+// the contents are seeked past.
+//
+// Unlike a tapeStream, it doesn't read the OVA start to end, so it can't
+// check the package checksum against the bytes that are uploaded.
+type tapeIndex struct {
+	archive *TapeArchive
+	f       *os.File
+	entries []tapeIndexEntry
+}
+
+type tapeIndexEntry struct {
+	name   string
+	offset int64
+	size   int64
+}
+
+// newTapeIndex indexes the local OVA behind pkg, checking that its
+// descriptor is still the one the import spec was created from.
+func newTapeIndex(archive *TapeArchive, pkg *Package) (*tapeIndex, error) {
+	f, err := os.Open(archive.Path)
+	if err != nil {
+		return nil, err
+	}
+	t := &tapeIndex{archive: archive, f: f}
+
+	// tar.Reader reads whole header blocks and nothing more, and skips
+	// contents by seeking, so right after Next the file is positioned at the
+	// start of the entry's contents.
+	r := tar.NewReader(f)
+	descriptorChecked := false
+	for {
+		h, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failure reading %s: %s", archive.Path, err)
+		}
+		offset, err := f.Seek(0, io.SeekCurrent)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		entry := tapeIndexEntry{name: tapeEntryName(h), offset: offset, size: h.Size}
+		t.entries = append(t.entries, entry)
+
+		if !descriptorChecked && hasExtension(".ovf")(entry.name) {
+			descriptorChecked = true
+			if err := t.checkDescriptor(entry, pkg.Descriptor); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	return t, nil
+}
+
+// checkDescriptor makes sure the descriptor in the OVA is the one the import
+// spec was created from.
+func (t *tapeIndex) checkDescriptor(entry tapeIndexEntry, descriptor []byte) error {
+	contents, err := ioutil.ReadAll(io.NewSectionReader(t.f, entry.offset, entry.size))
+	if err != nil {
+		return fmt.Errorf("failure reading %s: %s", t.archive.Path, err)
+	}
+	if !bytes.Equal(contents, descriptor) {
+		return fmt.Errorf("the descriptor in %s changed while it was being imported", t.archive.Path)
+	}
+	return nil
+}
+
+// Open returns a reader for the contents of the entry called name. Readers
+// are independent of each other and can be used concurrently.
+func (t *tapeIndex) Open(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	for _, entry := range t.entries {
+		if entry.name == name || path.Base(entry.name) == name {
+			return ioutil.NopCloser(io.NewSectionReader(t.f, entry.offset, entry.size)), entry.size, nil
+		}
+	}
+	return nil, 0, &FileNotFoundError{fmt.Sprintf("%s in %s", name, t.archive.Path)}
+}
+
+// Close closes the OVA. Readers handed out by Open stop working.
+func (t *tapeIndex) Close() error {
+	return t.f.Close()
+}
@@ -0,0 +1,85 @@
+package helper
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTapeIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"test.ovf":        "<Envelope/>",
+		"test-disk1.vmdk": strings.Repeat("disk one ", 1000),
+		"test-disk2.vmdk": strings.Repeat("disk two ", 2000),
+		"test-disk3.vmdk": "small disk",
+	}
+	p := writeTestOVA(t, dir, files)
+
+	index, err := newTapeIndex(&TapeArchive{Path: p}, &Package{Descriptor: []byte("<Envelope/>")})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer index.Close()
+
+	// Entries can be read at the same time, in any order.
+	names := []string{"test-disk3.vmdk", "test-disk1.vmdk", "test-disk2.vmdk", "test.ovf"}
+	bodies := make([]string, len(names))
+	errs := make([]error, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			r, _, err := index.Open(context.Background(), name)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			defer r.Close()
+			body, err := ioutil.ReadAll(r)
+			bodies[i], errs[i] = string(body), err
+		}(i, name)
+	}
+	wg.Wait()
+	for i, name := range names {
+		if errs[i] != nil {
+			t.Fatalf("%s: err: %s", name, errs[i])
+		}
+		if bodies[i] != files[name] {
+			t.Fatalf("%s: bad contents: %q", name, bodies[i])
+		}
+	}
+
+	if _, _, err := index.Open(context.Background(), "missing.vmdk"); err == nil {
+		t.Fatal("expected an error for a missing entry")
+	} else if _, ok := err.(*FileNotFoundError); !ok {
+		t.Fatalf("expected FileNotFoundError, got %T: %s", err, err)
+	}
+}
+
+func TestTapeIndex_changedDescriptor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":        "<Envelope/>",
+		"test-disk1.vmdk": "disk contents",
+	})
+
+	_, err = newTapeIndex(&TapeArchive{Path: p}, &Package{Descriptor: []byte("<Envelope></Envelope>")})
+	if err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("expected a changed descriptor error, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package helper
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"log"
+	"path"
+	"strings"
+)
+
+// tapeStream reads an OVA in a single pass, handing out its entries in the
+// order they appear, so a remote OVA is downloaded once however many files it
+// holds. Every byte read goes through the package checksum, if there is one,
+// so once the stream has been read to the end the checksum vouches for
+// exactly the bytes that were handed out.
+//
+// Entries are opened one at a time: opening the next one discards whatever
+// is left of the previous one.
+type tapeStream struct {
+	archive    *TapeArchive
+	descriptor []byte
+	checksum   *Checksum
+
+	f io.ReadCloser
+	r io.Reader
+	t *tar.Reader
+
+	// h is nil if there is no checksum.
+	h hash.Hash
+
+	// next is the header of the entry after the current one, once peek has
+	// read it.
+	next *tar.Header
+
+	// passed holds the names of the entries read past without being opened.
+	passed map[string]bool
+}
+
+// newTapeStream opens the OVA behind pkg for a single pass. ctx bounds the
+// whole pass, so it has to outlive every upload that reads from the stream.
+func newTapeStream(ctx context.Context, archive *TapeArchive, pkg *Package) (*tapeStream, error) {
+	var h hash.Hash
+	if pkg.Checksum != nil {
+		var err error
+		if h, err = pkg.Checksum.newHash(); err != nil {
+			return nil, err
+		}
+	}
+
+	f, _, err := openSource(ctx, archive.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var r io.Reader = f
+	if h != nil {
+		r = io.TeeReader(f, h)
+	}
+	return &tapeStream{
+		archive:    archive,
+		descriptor: pkg.Descriptor,
+		checksum:   pkg.Checksum,
+		f:          f,
+		r:          r,
+		t:          tar.NewReader(r),
+		h:          h,
+		passed:     map[string]bool{},
+	}, nil
+}
+
+// Open skips ahead to the entry called name. The stream's own context bounds
+// the read.
+//
+// An entry that has already been passed has to be read again separately,
+// which is only allowed without a checksum: its contents would not be the
+// ones the checksum covers.
+func (s *tapeStream) Open(ctx context.Context, name string) (io.ReadCloser, int64, error) {
+	if s.passed[name] {
+		if s.checksum != nil {
+			return nil, 0, fmt.Errorf("%s comes before the files listed ahead of it in %s, so it can't be verified against the checksum in one pass", name, s.archive.Path)
+		}
+		log.Printf("[WARN] %s is out of order in %s, reading it again separately", name, s.archive.Path)
+		return s.archive.Open(ctx, name)
+	}
+
+	for {
+		h, err := s.peek()
+		if err == io.EOF {
+			return nil, 0, &FileNotFoundError{fmt.Sprintf("%s in %s", name, s.archive.Path)}
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		s.next = nil
+
+		entry := tapeEntryName(h)
+		if entry == name || path.Base(entry) == name {
+			return ioutil.NopCloser(s.t), h.Size, nil
+		}
+
+		if hasExtension(".ovf")(entry) {
+			if err := s.checkDescriptor(); err != nil {
+				return nil, 0, err
+			}
+		}
+		s.passed[entry] = true
+		s.passed[path.Base(entry)] = true
+	}
+}
+
+// peek returns the header of the next entry without moving past it.
+func (s *tapeStream) peek() (*tar.Header, error) {
+	if s.next != nil {
+		return s.next, nil
+	}
+
+	h, err := s.t.Next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failure reading %s: %s", s.archive.Path, err)
+	}
+	s.next = h
+	return h, nil
+}
+
+// nextName returns the name of the next entry, or an empty string at the end
+// of the stream.
+func (s *tapeStream) nextName() (string, error) {
+	h, err := s.peek()
+	if err == io.EOF {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return tapeEntryName(h), nil
+}
+
+// checkDescriptor makes sure the descriptor in the stream is the one the
+// import spec was created from.
+func (s *tapeStream) checkDescriptor() error {
+	contents, err := ioutil.ReadAll(s.t)
+	if err != nil {
+		return fmt.Errorf("failure reading %s: %s", s.archive.Path, err)
+	}
+	if !bytes.Equal(contents, s.descriptor) {
+		return fmt.Errorf("the descriptor in %s changed while it was being imported", s.archive.Path)
+	}
+	return nil
+}
+
+// Finish reads the rest of the OVA and compares its digest to the checksum,
+// if there is one. It should only be called once everything has been
+// uploaded.
+func (s *tapeStream) Finish() error {
+	if s.h == nil {
+		return nil
+	}
+	if _, err := io.Copy(ioutil.Discard, s.r); err != nil {
+		return fmt.Errorf("failure reading %s: %s", s.archive.Path, err)
+	}
+	if sum := s.h.Sum(nil); !bytes.Equal(sum, s.checksum.Sum) {
+		return fmt.Errorf("%s checksum mismatch for %s: expected %x, got %x", s.checksum.Algorithm, s.archive.Path, s.checksum.Sum, sum)
+	}
+	return nil
+}
+
+// Close closes the OVA without reading the rest of it.
+func (s *tapeStream) Close() error {
+	return s.f.Close()
+}
+
+// tapeEntryName returns the name of a tar entry as the descriptor would refer
+// to it.
+func tapeEntryName(h *tar.Header) string {
+	return strings.TrimPrefix(path.Clean(h.Name), "./")
+}
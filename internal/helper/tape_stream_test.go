@@ -0,0 +1,148 @@
+package helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vmware/govmomi/ovf"
+)
+
+func testTapeStream(t *testing.T, p string, descriptor string, checksum string) *tapeStream {
+	t.Helper()
+	pkg := &Package{Descriptor: []byte(descriptor)}
+	if checksum != "" {
+		c, err := ParseChecksum(checksum)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		pkg.Checksum = c
+	}
+	s, err := newTapeStream(context.Background(), &TapeArchive{Path: p}, pkg)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return s
+}
+
+func testReadEntry(t *testing.T, archive Archive, name string) string {
+	t.Helper()
+	r, _, err := archive.Open(context.Background(), name)
+	if err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	defer r.Close()
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: err: %s", name, err)
+	}
+	return string(body)
+}
+
+func TestTapeStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":        "<Envelope/>",
+		"test-disk1.vmdk": "disk contents",
+		"test-disk2.vmdk": "more disk contents",
+	})
+	contents, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	good := fmt.Sprintf("sha256:%x", sha256.Sum256(contents))
+	bad := "sha256:" + strings.Repeat("00", 32)
+
+	s := testTapeStream(t, p, "<Envelope/>", good)
+	defer s.Close()
+	if body := testReadEntry(t, s, "test-disk1.vmdk"); body != "disk contents" {
+		t.Fatalf("bad contents: %q", body)
+	}
+	if body := testReadEntry(t, s, "test-disk2.vmdk"); body != "more disk contents" {
+		t.Fatalf("bad contents: %q", body)
+	}
+	if err := s.Finish(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s = testTapeStream(t, p, "<Envelope/>", bad)
+	defer s.Close()
+	testReadEntry(t, s, "test-disk2.vmdk")
+	if err := s.Finish(); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+
+	// Entries that have been read past can't be verified any more.
+	s = testTapeStream(t, p, "<Envelope/>", good)
+	defer s.Close()
+	testReadEntry(t, s, "test-disk2.vmdk")
+	if _, _, err := s.Open(context.Background(), "test-disk1.vmdk"); err == nil {
+		t.Fatal("expected error opening an entry out of order")
+	}
+
+	// Without a checksum they are read again separately.
+	s = testTapeStream(t, p, "<Envelope/>", "")
+	defer s.Close()
+	testReadEntry(t, s, "test-disk2.vmdk")
+	if body := testReadEntry(t, s, "test-disk1.vmdk"); body != "disk contents" {
+		t.Fatalf("bad contents: %q", body)
+	}
+	if err := s.Finish(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The descriptor has to be the one the import was planned with.
+	s = testTapeStream(t, p, "<Other/>", good)
+	defer s.Close()
+	if _, _, err := s.Open(context.Background(), "test-disk1.vmdk"); err == nil || !strings.Contains(err.Error(), "changed") {
+		t.Fatalf("expected the descriptor to be checked, got %v", err)
+	}
+}
+
+func TestTapeStream_unsizedChunks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := writeTestOVA(t, dir, map[string]string{
+		"test.ovf":                  "<Envelope/>",
+		"test-disk1.vmdk.000000000": "disk ",
+		"test-disk1.vmdk.000000001": "contents",
+		"test-disk2.vmdk":           "more disk contents",
+	})
+	contents, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	s := testTapeStream(t, p, "<Envelope/>", fmt.Sprintf("sha256:%x", sha256.Sum256(contents)))
+	defer s.Close()
+
+	// Without a declared size, chunks are read until the next one is missing,
+	// which must not skip the files after them.
+	chunkSize := 5
+	body, _, err := testReadPackageFile(t, s, nil, ovf.File{Href: "test-disk1.vmdk", ChunkSize: &chunkSize})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if string(body) != "disk contents" {
+		t.Fatalf("bad contents: %q", body)
+	}
+	if body := testReadEntry(t, s, "test-disk2.vmdk"); body != "more disk contents" {
+		t.Fatalf("bad contents: %q", body)
+	}
+	if err := s.Finish(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+}
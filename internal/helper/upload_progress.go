@@ -0,0 +1,201 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/vim25/progress"
+)
+
+// uploadProgressInterval is how often upload progress is logged.
+const uploadProgressInterval = 10 * time.Second
+
+// uploadProgress tracks the uploads of an import so they can be logged while
+// they run, instead of the import sitting silent for many minutes.
+type uploadProgress struct {
+	mu    sync.Mutex
+	files []*fileProgress
+	last  int64
+}
+
+type fileProgress struct {
+	path    string
+	size    int64
+	pos     int64
+	rate    string
+	started bool
+	done    bool
+}
+
+func newUploadProgress(items []nfc.FileItem) *uploadProgress {
+	p := &uploadProgress{}
+	for _, item := range items {
+		p.files = append(p.files, &fileProgress{path: item.Path, size: item.Size})
+	}
+	return p
+}
+
+// sink returns a progress sink for the upload of path, which sends size
+// bytes, or an unknown amount if size is negative. The size replaces the one
+// the lease declared.
+func (p *uploadProgress) sink(path string, size int64) progress.Sinker {
+	p.mu.Lock()
+	var f *fileProgress
+	for _, file := range p.files {
+		if file.path == path {
+			f = file
+		}
+	}
+	if f == nil {
+		f = &fileProgress{path: path}
+		p.files = append(p.files, f)
+	}
+	f.size = size
+	p.mu.Unlock()
+
+	return progress.SinkFunc(func() chan<- progress.Report {
+		ch := make(chan progress.Report)
+		go func() {
+			for r := range ch {
+				p.mu.Lock()
+				f.started = true
+				if f.size > 0 {
+					f.pos = int64(float64(r.Percentage()) / 100 * float64(f.size))
+				}
+				f.rate = r.Detail()
+				p.mu.Unlock()
+			}
+
+			p.mu.Lock()
+			f.done = true
+			p.mu.Unlock()
+		}()
+		return ch
+	})
+}
+
+// uploadSink returns the sink for the upload of f to item, which sends size
+// bytes, or an unknown amount if size is negative. It reports to lease, the
+// item's own sink that keeps the lease alive, as well as to p.
+//
+// Reports measured against an unknown size are meaningless, and outside the
+// 0-100 range the lease accepts, so for those uploads they are replaced by
+// ones measuring how much of the package file, of the size the lease
+// declared, has been read.
+func uploadSink(lease progress.Sinker, p *uploadProgress, item nfc.FileItem, f *PackageFile, size int64) progress.Sinker {
+	if size >= 0 {
+		return progress.Tee(lease, p.sink(item.Path, size))
+	}
+	return &packageReadSink{
+		sink: progress.Tee(lease, p.sink(item.Path, item.Size)),
+		f:    f,
+		size: item.Size,
+	}
+}
+
+// packageReadSink forwards reports to sink, rewritten to measure how much of
+// a package file of size bytes has been read.
+type packageReadSink struct {
+	sink progress.Sinker
+	f    *PackageFile
+	size int64
+}
+
+func (s *packageReadSink) Sink() chan<- progress.Report {
+	ch := make(chan progress.Report)
+	out := s.sink.Sink()
+	go func() {
+		defer close(out)
+		for r := range ch {
+			out <- packageReadReport{Report: r, pos: s.f.Position(), size: s.size}
+		}
+	}()
+	return ch
+}
+
+type packageReadReport struct {
+	progress.Report
+	pos  int64
+	size int64
+}
+
+func (r packageReadReport) Percentage() float32 {
+	if r.size <= 0 {
+		return 0
+	}
+	if r.pos >= r.size {
+		return 100
+	}
+	return 100 * float32(r.pos) / float32(r.size)
+}
+
+// run logs progress every interval until ctx is done.
+func (p *uploadProgress) run(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+			for _, line := range p.report(interval) {
+				log.Printf("[INFO] %s", line)
+			}
+		}
+	}
+}
+
+// report describes the files being uploaded, then the import as a whole,
+// with its throughput over the last interval.
+func (p *uploadProgress) report(interval time.Duration) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var lines []string
+	var pos, size int64
+	for _, f := range p.files {
+		if f.size > 0 {
+			pos += f.pos
+			size += f.size
+		}
+		if f.started && !f.done {
+			lines = append(lines, fmt.Sprintf("ova upload: file=%s progress=%s transferred=%s/%s rate=%s",
+				f.path, percentage(f.pos, f.size), formatBytes(f.pos), formatBytes(f.size), f.rate))
+		}
+	}
+
+	rate := float64(pos-p.last) / interval.Seconds()
+	p.last = pos
+	lines = append(lines, fmt.Sprintf("ova upload: total progress=%s transferred=%s/%s rate=%s/s",
+		percentage(pos, size), formatBytes(pos), formatBytes(size), formatBytes(int64(rate))))
+
+	return lines
+}
+
+func percentage(pos, size int64) string {
+	if size <= 0 {
+		return "?"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(pos)/float64(size))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < 0 {
+		return "?"
+	}
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,144 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vmware/govmomi/nfc"
+	"github.com/vmware/govmomi/ovf"
+	"github.com/vmware/govmomi/vim25/progress"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+type testReport float32
+
+func (r testReport) Percentage() float32 { return float32(r) }
+func (r testReport) Detail() string      { return "1.0MiB/s" }
+func (r testReport) Error() error        { return nil }
+
+func TestUploadProgress(t *testing.T) {
+	items := []nfc.FileItem{
+		nfc.NewFileItem(&url.URL{}, types.OvfFileItem{Path: "disk1.vmdk", Size: 1024}),
+		nfc.NewFileItem(&url.URL{}, types.OvfFileItem{Path: "disk2.vmdk.gz", Size: 512}),
+	}
+	p := newUploadProgress(items)
+
+	// The gzip file uploads more bytes than the lease declared.
+	ch := p.sink("disk2.vmdk.gz", 3072).Sink()
+	ch <- testReport(50)
+	close(ch)
+
+	// Wait for the sink to record the file as done.
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		done := p.files[1].done
+		p.mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	lines := p.report(time.Second)
+	if len(lines) != 1 {
+		t.Fatalf("expected only the total for finished files, got %q", lines)
+	}
+	expected := "ova upload: total progress=37.5% transferred=1.5KiB/4.0KiB rate=1.5KiB/s"
+	if lines[0] != expected {
+		t.Fatalf("expected %q, got %q", expected, lines[0])
+	}
+
+	// Throughput is measured since the previous report.
+	if lines := p.report(time.Second); !strings.HasSuffix(lines[0], "rate=0B/s") {
+		t.Fatalf("expected no throughput, got %q", lines[0])
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, expected := range map[int64]string{
+		-1:          "?",
+		0:           "0B",
+		1023:        "1023B",
+		1536:        "1.5KiB",
+		5 << 30:     "5.0GiB",
+		3 << 20 / 2: "1.5MiB",
+	} {
+		if actual := formatBytes(n); actual != expected {
+			t.Fatalf("%d: expected %q, got %q", n, expected, actual)
+		}
+	}
+}
+
+func TestUploadSink_unknownSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ovf")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	contents := make([]byte, 1000)
+	rand.New(rand.NewSource(1)).Read(contents)
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	w.Write(contents)
+	w.Close()
+	testWriteFiles(t, dir, map[string][]byte{"test-disk1.vmdk.gz": compressed.Bytes()})
+
+	gz := "gzip"
+	f, size, err := OpenPackageFile(context.Background(), testOpenArchive(t, filepath.Join(dir, "test.ovf")), nil, ovf.File{Href: "test-disk1.vmdk.gz", Compression: &gz})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer f.Close()
+	if size != -1 {
+		t.Fatalf("expected an unknown size, got %d", size)
+	}
+
+	var reports []float32
+	done := make(chan struct{})
+	lease := progress.SinkFunc(func() chan<- progress.Report {
+		ch := make(chan progress.Report)
+		go func() {
+			defer close(done)
+			for r := range ch {
+				reports = append(reports, r.Percentage())
+			}
+		}()
+		return ch
+	})
+
+	item := nfc.NewFileItem(&url.URL{}, types.OvfFileItem{Path: "test-disk1.vmdk.gz", Size: int64(compressed.Len())})
+	p := newUploadProgress([]nfc.FileItem{item})
+
+	// Drive the sink the way the upload does, with reports measured against
+	// the unknown length.
+	upload := progress.NewReader(context.Background(), uploadSink(lease, p, item, f, size), f, size)
+	if _, err := io.Copy(ioutil.Discard, upload); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	upload.Done(nil)
+	<-done
+
+	if len(reports) == 0 {
+		t.Fatal("expected progress reports")
+	}
+	for _, r := range reports {
+		if r < 0 || r > 100 {
+			t.Fatalf("expected progress within 0-100, got %v", reports)
+		}
+	}
+	if last := reports[len(reports)-1]; last != 100 {
+		t.Fatalf("expected the upload to end at 100%%, got %v", last)
+	}
+}
@@ -0,0 +1,257 @@
+package helper
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/vmware/govmomi"
+	"github.com/vmware/govmomi/find"
+	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+)
+
+// adapted from tf vsphere provider internals
+
+// UUIDNotFoundError is returned when a virtual machine could not be found by
+// UUID.
+type UUIDNotFoundError struct {
+	s string
+}
+
+// Error implements error for UUIDNotFoundError.
+func (e *UUIDNotFoundError) Error() string {
+	return e.s
+}
+
+// FromUUID locates a virtual machine or template by its BIOS UUID.
+func FromUUID(client *govmomi.Client, uuid string) (*object.VirtualMachine, error) {
+	log.Printf("[DEBUG] Locating virtual machine with UUID %q", uuid)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	instanceUUID := false
+	search := object.NewSearchIndex(client.Client)
+	result, err := search.FindByUuid(ctx, nil, uuid, true, &instanceUUID)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, &UUIDNotFoundError{fmt.Sprintf("virtual machine with UUID %q not found", uuid)}
+	}
+
+	// Run the reference through the finder so InventoryPath gets populated.
+	finder := find.NewFinder(client.Client, false)
+	vm, err := finder.ObjectReference(ctx, result.Reference())
+	if err != nil {
+		return nil, err
+	}
+
+	return vm.(*object.VirtualMachine), nil
+}
+
+// FromPath locates a virtual machine or template by its inventory path.
+func FromPath(client *govmomi.Client, path string) (*object.VirtualMachine, error) {
+	log.Printf("[DEBUG] Locating virtual machine at %q", path)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	finder := find.NewFinder(client.Client, false)
+	return finder.VirtualMachine(ctx, path)
+}
+
+// FromName locates a virtual machine or template by name anywhere in a
+// datacenter's VM folder.
+func FromName(client *govmomi.Client, dc *object.Datacenter, name string) (*object.VirtualMachine, error) {
+	log.Printf("[DEBUG] Locating virtual machine %q in datacenter %q", name, dc.InventoryPath)
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	finder := find.NewFinder(client.Client, false)
+	finder.SetDatacenter(dc)
+	return finder.VirtualMachine(ctx, name)
+}
+
+// FromMOID locates a virtual machine by its managed object reference ID.
+func FromMOID(client *govmomi.Client, id string) (*object.VirtualMachine, error) {
+	vm, err := FromID(client, "VirtualMachine", id)
+	if err != nil {
+		return nil, err
+	}
+	return vm.(*object.VirtualMachine), nil
+}
+
+// Properties fetches the VirtualMachine MO for a virtual machine.
+func Properties(vm *object.VirtualMachine) (*mo.VirtualMachine, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultAPITimeout)
+	defer cancel()
+
+	var props mo.VirtualMachine
+	if err := vm.Properties(ctx, vm.Reference(), nil, &props); err != nil {
+		return nil, err
+	}
+	return &props, nil
+}
+
+// ExtraConfigValue returns the value of an extraConfig option of a virtual
+// machine, or an empty string if it isn't set.
+func ExtraConfigValue(props *mo.VirtualMachine, key string) string {
+	if props.Config == nil {
+		return ""
+	}
+	for _, opt := range props.Config.ExtraConfig {
+		if v := opt.GetOptionValue(); v.Key == key {
+			if s, ok := v.Value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// IsManagedObjectNotFoundError checks an error to see if it's of the
+// ManagedObjectNotFound type.
+func IsManagedObjectNotFoundError(err error) bool {
+	if soap.IsSoapFault(err) {
+		if _, ok := soap.ToSoapFault(err).VimFault().(types.ManagedObjectNotFound); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsNotFoundError checks an error to see if it means a virtual machine looked
+// up by UUID or MOID no longer exists.
+func IsNotFoundError(err error) bool {
+	if _, ok := err.(*UUIDNotFoundError); ok {
+		return true
+	}
+	return IsManagedObjectNotFoundError(err)
+}
+
+// MarkAsTemplate converts a virtual machine into a template, giving up when
+// ctx is done.
+func MarkAsTemplate(ctx context.Context, vm *object.VirtualMachine) error {
+	log.Printf("[DEBUG] Marking virtual machine %q as a template", vm.InventoryPath)
+	return vm.MarkAsTemplate(ctx)
+}
+
+// MarkAsVirtualMachine converts a template back into a virtual machine,
+// placing it in the given resource pool and, if set, on host, giving up when
+// ctx is done.
+func MarkAsVirtualMachine(ctx context.Context, vm *object.VirtualMachine, pool *object.ResourcePool, host *object.HostSystem) error {
+	log.Printf("[DEBUG] Marking template %q as a virtual machine", vm.InventoryPath)
+	return vm.MarkAsVirtualMachine(ctx, *pool, host)
+}
+
+// PowerOff forces a virtual machine off and waits for the task to complete
+// or ctx to be done.
+func PowerOff(ctx context.Context, vm *object.VirtualMachine) error {
+	log.Printf("[DEBUG] Forcing power off of virtual machine %q", vm.InventoryPath)
+
+	task, err := vm.PowerOff(ctx)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Destroy deletes a virtual machine along with its disks and waits for the
+// task to complete or ctx to be done.
+func Destroy(ctx context.Context, vm *object.VirtualMachine) error {
+	log.Printf("[DEBUG] Deleting virtual machine %q", vm.InventoryPath)
+
+	task, err := vm.Destroy(ctx)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Rename renames a virtual machine and waits for the task to complete or ctx
+// to be done.
+func Rename(ctx context.Context, vm *object.VirtualMachine, name string) error {
+	log.Printf("[DEBUG] Renaming virtual machine %q to %q", vm.InventoryPath, name)
+
+	task, err := vm.Rename(ctx, name)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// MoveToFolder moves a virtual machine into folder and waits for the task to
+// complete or ctx to be done.
+func MoveToFolder(ctx context.Context, vm *object.VirtualMachine, folder *object.Folder) error {
+	log.Printf("[DEBUG] Moving virtual machine %q to folder %q", vm.InventoryPath, folder.InventoryPath)
+
+	task, err := folder.MoveInto(ctx, []types.ManagedObjectReference{vm.Reference()})
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// Relocate migrates a virtual machine as described by spec and waits for the
+// task to complete or ctx to be done.
+func Relocate(ctx context.Context, vm *object.VirtualMachine, spec types.VirtualMachineRelocateSpec) error {
+	log.Printf("[DEBUG] Relocating virtual machine %q", vm.InventoryPath)
+
+	task, err := vm.Relocate(ctx, spec, types.VirtualMachineMovePriorityDefaultPriority)
+	if err != nil {
+		return err
+	}
+	return task.Wait(ctx)
+}
+
+// SetAnnotation replaces the notes on a virtual machine, clearing them if
+// annotation is empty, and waits for the task to complete or ctx to be done.
+func SetAnnotation(ctx context.Context, vm *object.VirtualMachine, annotation string) error {
+	log.Printf("[DEBUG] Setting annotation on virtual machine %q", vm.InventoryPath)
+
+	ref, err := reconfigureAnnotation(ctx, vm.Client(), vm.Reference(), annotation)
+	if err != nil {
+		return err
+	}
+	return object.NewTask(vm.Client(), ref).Wait(ctx)
+}
+
+// annotationSpec is the part of a VirtualMachineConfigSpec that holds the
+// notes. types.VirtualMachineConfigSpec omits an empty annotation, which
+// vSphere takes as "leave it alone", so clearing the notes needs a spec that
+// always sends it.
+type annotationSpec struct {
+	Annotation string `xml:"annotation"`
+}
+
+type reconfigAnnotationRequest struct {
+	This types.ManagedObjectReference `xml:"_this"`
+	Spec annotationSpec               `xml:"spec"`
+}
+
+type reconfigAnnotationBody struct {
+	Req    *reconfigAnnotationRequest     `xml:"urn:vim25 ReconfigVM_Task,omitempty"`
+	Res    *types.ReconfigVM_TaskResponse `xml:"urn:vim25 ReconfigVM_TaskResponse,omitempty"`
+	Fault_ *soap.Fault                    `xml:"http://schemas.xmlsoap.org/soap/envelope/ Fault,omitempty"`
+}
+
+func (b *reconfigAnnotationBody) Fault() *soap.Fault { return b.Fault_ }
+
+// reconfigureAnnotation starts a ReconfigVM_Task that sets the annotation of
+// the virtual machine ref, even to the empty string, and returns the task.
+func reconfigureAnnotation(ctx context.Context, rt soap.RoundTripper, ref types.ManagedObjectReference, annotation string) (types.ManagedObjectReference, error) {
+	var reqBody, resBody reconfigAnnotationBody
+	reqBody.Req = &reconfigAnnotationRequest{
+		This: ref,
+		Spec: annotationSpec{Annotation: annotation},
+	}
+	if err := rt.RoundTrip(ctx, &reqBody, &resBody); err != nil {
+		return types.ManagedObjectReference{}, err
+	}
+	if resBody.Res == nil {
+		return types.ManagedObjectReference{}, fmt.Errorf("no task returned by ReconfigVM_Task")
+	}
+	return resBody.Res.Returnval, nil
+}
@@ -0,0 +1,47 @@
+package helper
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/vmware/govmomi/vim25/soap"
+	"github.com/vmware/govmomi/vim25/types"
+	"github.com/vmware/govmomi/vim25/xml"
+)
+
+// testRoundTripper records the encoded request and answers with a task.
+type testRoundTripper struct {
+	request string
+}
+
+func (rt *testRoundTripper) RoundTrip(ctx context.Context, req, res soap.HasFault) error {
+	b, err := xml.Marshal(req)
+	if err != nil {
+		return err
+	}
+	rt.request = string(b)
+	res.(*reconfigAnnotationBody).Res = &types.ReconfigVM_TaskResponse{
+		Returnval: types.ManagedObjectReference{Type: "Task", Value: "task-1"},
+	}
+	return nil
+}
+
+func TestReconfigureAnnotation_clear(t *testing.T) {
+	rt := &testRoundTripper{}
+	vm := types.ManagedObjectReference{Type: "VirtualMachine", Value: "vm-1"}
+
+	task, err := reconfigureAnnotation(context.Background(), rt, vm, "")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if task.Value != "task-1" {
+		t.Fatalf("bad task: %v", task)
+	}
+	if !strings.Contains(rt.request, "<spec><annotation></annotation></spec>") {
+		t.Fatalf("empty annotation not sent: %s", rt.request)
+	}
+	if !strings.Contains(rt.request, `<_this type="VirtualMachine">vm-1</_this>`) {
+		t.Fatalf("bad target: %s", rt.request)
+	}
+}
@@ -1,31 +1,128 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/url"
+	"sync"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/hashicorp/terraform/terraform"
+	"github.com/rowanjacobs/ova-provider-spike/internal/helper"
 	"github.com/terraform-providers/terraform-provider-vsphere/vsphere"
+	"github.com/vmware/govmomi"
+	"github.com/vmware/vic/pkg/vsphere/tags"
 )
 
+// ProviderMeta is handed to resources by providerConfigure: the vSphere
+// connection, plus provider-wide defaults. The connection is only opened
+// when something first asks for a client, so data sources that just read a
+// package work without vSphere credentials.
+type ProviderMeta struct {
+	// UploadParallelism is the number of files to upload at once when a
+	// resource doesn't set its own limit.
+	UploadParallelism int
+
+	// StopContext is cancelled when Terraform stops the provider, e.g. on
+	// Ctrl-C, so long running imports can bail out and clean up.
+	StopContext context.Context
+
+	config *vsphere.Config
+
+	mu         sync.Mutex
+	client     *govmomi.Client
+	tagsClient *tags.RestClient
+}
+
+// Client returns the vSphere SOAP client, logging in on first use.
+func (m *ProviderMeta) Client() (*govmomi.Client, error) {
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	return m.client, nil
+}
+
+// TagsClient returns the CIS REST client, logging in on first use. It is nil
+// when the endpoint doesn't support tags.
+func (m *ProviderMeta) TagsClient() (*tags.RestClient, error) {
+	if err := m.connect(); err != nil {
+		return nil, err
+	}
+	return m.tagsClient, nil
+}
+
+// connect sets up the VIM/govmomi client connection and the CIS REST client,
+// or loads previous sessions, unless that has already happened. A failed
+// attempt isn't remembered, so the next caller tries again.
+func (m *ProviderMeta) connect() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.client != nil {
+		return nil
+	}
+
+	c := m.config
+	if c.User == "" || c.Password == "" || c.VSphereServer == "" {
+		return fmt.Errorf("user, password and vsphere_server must be set to talk to vSphere")
+	}
+
+	u, err := url.Parse("https://" + c.VSphereServer + "/sdk")
+	if err != nil {
+		return fmt.Errorf("Error parse url: %s", err)
+	}
+	u.User = url.UserPassword(c.User, c.Password)
+
+	client, err := c.SavedVimSessionOrNew(u)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[DEBUG] VMWare vSphere Client configured for URL: %s", c.VSphereServer)
+
+	var tagsClient *tags.RestClient
+	if helper.TagsSupported(client) {
+		// Connect to the CIS REST endpoint for tagging, or load a previous session
+		tagsClient, err = c.SavedRestSessionOrNew(u)
+		if err != nil {
+			return err
+		}
+		log.Println("[DEBUG] CIS REST client configuration successful")
+	} else {
+		log.Printf("[DEBUG] Connected endpoint does not support tags (%s)", client.ServiceContent.About.FullName)
+	}
+
+	if err := c.SaveVimClient(client); err != nil {
+		return fmt.Errorf("error persisting SOAP session to disk: %s", err)
+	}
+	if tagsClient != nil {
+		if err := c.SaveRestClient(tagsClient); err != nil {
+			return fmt.Errorf("error persisting REST session to disk: %s", err)
+		}
+	}
+
+	m.client = client
+	m.tagsClient = tagsClient
+	return nil
+}
+
 // Provider returns a terraform.ResourceProvider.
 func Provider() terraform.ResourceProvider {
-	return &schema.Provider{
+	p := &schema.Provider{
 		Schema: map[string]*schema.Schema{
 			"user": &schema.Schema{
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_USER", nil),
-				Description: "The user name for vSphere API operations.",
+				Description: "The user name for vSphere API operations. Only needed by resources and data sources that talk to vSphere.",
 			},
 
 			"password": &schema.Schema{
 				Type:        schema.TypeString,
-				Required:    true,
+				Optional:    true,
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_PASSWORD", nil),
-				Description: "The user password for vSphere API operations.",
+				Description: "The user password for vSphere API operations. Only needed by resources and data sources that talk to vSphere.",
 			},
 			"vsphere_server": &schema.Schema{
 				Type:        schema.TypeString,
@@ -39,66 +136,43 @@ func Provider() terraform.ResourceProvider {
 				DefaultFunc: schema.EnvDefaultFunc("VSPHERE_ALLOW_UNVERIFIED_SSL", false),
 				Description: "If set, VMware vSphere client will permit unverifiable SSL certificates.",
 			},
+			"upload_parallelism": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("OVA_UPLOAD_PARALLELISM", 4),
+				Description:  "The default number of files to upload at once when importing. A remote OVA, or one with a checksum, is read in a single pass, so its files are always uploaded one at a time.",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"ova_template": resourceTemplate(),
 		},
-		ConfigureFunc: providerConfigure,
-	}
-}
-
-func providerConfigure(d *schema.ResourceData) (interface{}, error) {
-	c, err := NewConfig(d)
-	if err != nil {
-		return nil, err
-	}
-
-	u, err := url.Parse("https://" + c.VSphereServer + "/sdk")
-	if err != nil {
-		return nil, fmt.Errorf("Error parse url: %s", err)
-	}
-
-	u.User = url.UserPassword(c.User, c.Password)
-	if err != nil {
-		return nil, fmt.Errorf("Error generating SOAP endpoint url: %s", err)
+		DataSourcesMap: map[string]*schema.Resource{
+			"ova_descriptor": dataSourceDescriptor(),
+			"ova_template":   dataSourceTemplate(),
+		},
 	}
-
-	// Set up the VIM/govmomi client connection, or load a previous session
-	client, err := c.SavedVimSessionOrNew(u)
-	if err != nil {
-		return nil, err
+	p.ConfigureFunc = func(d *schema.ResourceData) (interface{}, error) {
+		return providerConfigure(d, p.StopContext())
 	}
-
-	log.Printf("[DEBUG] VMWare vSphere Client configured for URL: %s", c.VSphereServer)
-
-	if err := c.SaveVimClient(client); err != nil {
-		return nil, fmt.Errorf("error persisting SOAP session to disk: %s", err)
-	}
-
-	return client, nil
+	return p
 }
 
-// NewConfig returns a new Config from a supplied ResourceData.
-func NewConfig(d *schema.ResourceData) (*vsphere.Config, error) {
-	// Handle backcompat support for vcenter_server; once that is removed,
-	// vsphere_server can just become a Required field that is referenced inline
-	// in Config below.
-	server := d.Get("vsphere_server").(string)
-
-	if server == "" {
-		server = d.Get("vcenter_server").(string)
-	}
-
-	if server == "" {
-		return nil, fmt.Errorf("one of vsphere_server or [deprecated] vcenter_server must be provided")
-	}
+func providerConfigure(d *schema.ResourceData, stopCtx context.Context) (interface{}, error) {
+	return &ProviderMeta{
+		UploadParallelism: d.Get("upload_parallelism").(int),
+		StopContext:       stopCtx,
+		config:            NewConfig(d),
+	}, nil
+}
 
-	c := &vsphere.Config{
+// NewConfig returns a new Config from a supplied ResourceData. Nothing is
+// required yet: ProviderMeta checks the credentials when it first connects.
+func NewConfig(d *schema.ResourceData) *vsphere.Config {
+	return &vsphere.Config{
 		User:          d.Get("user").(string),
 		Password:      d.Get("password").(string),
 		InsecureFlag:  d.Get("allow_unverified_ssl").(bool),
-		VSphereServer: server,
+		VSphereServer: d.Get("vsphere_server").(string),
 	}
-
-	return c, nil
 }
@@ -4,6 +4,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 	main "github.com/rowanjacobs/ova-provider-spike"
@@ -29,6 +30,38 @@ func TestProvider_impl(t *testing.T) {
 	var _ terraform.ResourceProvider = main.Provider()
 }
 
+// testUnsetVSphereEnv unsets the vSphere credentials in the environment, and
+// returns a function that puts them back.
+func testUnsetVSphereEnv() func() {
+	saved := map[string]string{}
+	for _, k := range []string{"VSPHERE_USER", "VSPHERE_PASSWORD", "VSPHERE_SERVER"} {
+		if v, ok := os.LookupEnv(k); ok {
+			saved[k] = v
+			os.Unsetenv(k)
+		}
+	}
+	return func() {
+		for k, v := range saved {
+			os.Setenv(k, v)
+		}
+	}
+}
+
+// testUnconfiguredProvider returns a provider configured without any
+// attributes, which has no way to reach vSphere.
+func testUnconfiguredProvider(t *testing.T) *schema.Provider {
+	t.Helper()
+	provider := main.Provider().(*schema.Provider)
+	raw, err := config.NewRawConfig(map[string]interface{}{})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := provider.Configure(terraform.NewResourceConfig(raw)); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return provider
+}
+
 func testAccPreCheck(t *testing.T) {
 	if v := os.Getenv("VSPHERE_USER"); v == "" {
 		t.Fatal("VSPHERE_USER must be set for acceptance tests")
@@ -2,12 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/x509"
 	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
 
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 	"github.com/rowanjacobs/ova-provider-spike/internal/helper"
 	"github.com/vmware/govmomi"
 	"github.com/vmware/govmomi/object"
+	"github.com/vmware/govmomi/vim25/mo"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
 func resourceTemplate() *schema.Resource {
@@ -16,6 +24,20 @@ func resourceTemplate() *schema.Resource {
 		Read:   resourceTemplateRead,
 		Update: resourceTemplateUpdate,
 		Delete: resourceTemplateDelete,
+		Importer: &schema.ResourceImporter{
+			State: resourceTemplateImport,
+		},
+
+		CustomizeDiff: resourceTemplateCustomizeDiff,
+
+		// Imports upload whole disks, so creating can take hours. The
+		// timeouts only bound the long running operations; lookups keep
+		// failing fast.
+		Timeouts: &schema.ResourceTimeout{
+			Create: schema.DefaultTimeout(2 * time.Hour),
+			Update: schema.DefaultTimeout(30 * time.Minute),
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
 
 		Schema: map[string]*schema.Schema{
 			"name": &schema.Schema{
@@ -23,13 +45,27 @@ func resourceTemplate() *schema.Resource {
 				Required: true,
 			},
 			"path": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
-			},
-			"datastore_id": {
 				Type:        schema.TypeString,
 				Required:    true,
-				Description: "The ID of the template's datastore. The template configuration is placed here, along with any virtual disks that are created without datastores.",
+				Description: "The path or http(s) URL of an OVF descriptor, or of an OVA package containing one.",
+			},
+			"checksum": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Description:  "The expected digest of the file at path, as sha256:<hex>, sha512:<hex> or sha1:<hex>. An OVA is checked as it is uploaded, one file at a time, and the import fails before it completes on a mismatch.",
+				ValidateFunc: validateChecksum,
+			},
+			"datastore_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The ID or inventory path of the template's datastore. The template configuration is placed here, along with any virtual disks that are created without datastores.",
+				ConflictsWith: []string{"datastore_cluster_id"},
+			},
+			"datastore_cluster_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The ID of a datastore cluster to put the template in, on the datastore Storage DRS recommends.",
+				ConflictsWith: []string{"datastore_id"},
 			},
 			"datacenter": {
 				Type:        schema.TypeString,
@@ -44,37 +80,182 @@ func resourceTemplate() *schema.Resource {
 				StateFunc: helper.NormalizePath,
 			},
 			"resource_pool_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The ID or inventory path of a resource pool to put the template in.",
+				ConflictsWith: []string{"host_system_id", "compute_cluster_id"},
+			},
+			"host_system_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The ID of a host to put the template on, in the root resource pool of its cluster.",
+				ConflictsWith: []string{"resource_pool_id", "compute_cluster_id"},
+			},
+			"compute_cluster_id": {
+				Type:          schema.TypeString,
+				Optional:      true,
+				Description:   "The ID of a cluster to put the template in, in its root resource pool.",
+				ConflictsWith: []string{"resource_pool_id", "host_system_id"},
+			},
+			"network_mappings": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "A map of OVF network names to the path or ID of the vSphere network to attach them to.",
+			},
+			"default_network": {
 				Type:        schema.TypeString,
-				Required:    true,
-				Description: "The ID of a resource pool to put the template in.",
+				Optional:    true,
+				Description: "The path or ID of the vSphere network to use for OVF networks not listed in network_mappings. Defaults to a network with the same name as the OVF network.",
+			},
+			"properties": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Values for the vApp properties declared in the OVF's ProductSection, keyed by property ID.",
+				// Password properties are set here too, so keep all of them
+				// out of plan output.
+				Sensitive: true,
+			},
+			"deployment_option": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "The ID of the deployment configuration to import, from the OVF's DeploymentOptionSection. Defaults to the OVF's default configuration.",
+			},
+			"disk_provisioning": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The provisioning type for the imported disks: thin, thick (lazy-zeroed) or eagerZeroedThick. Defaults to whatever vCenter chooses.",
+				ValidateFunc: validation.StringInSlice([]string{
+					string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThin),
+					string(types.OvfCreateImportSpecParamsDiskProvisioningTypeThick),
+					string(types.OvfCreateImportSpecParamsDiskProvisioningTypeEagerZeroedThick),
+				}, false),
+			},
+			"storage_policy_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The ID of a VM storage policy to apply to the template and its disks.",
+			},
+			"certificate_policy": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      helper.CertificatePolicyWarn,
+				Description:  "What to do when the package is unsigned or its certificate is not trusted: ignore, warn, or require-trusted to fail the import.",
+				ValidateFunc: validation.StringInSlice(helper.CertificatePolicies, false),
+			},
+			"certificate_ca_bundle": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The path to a PEM encoded bundle of CA certificates to trust package signers against. Defaults to the system roots.",
+			},
+			"certificate_subject": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The subject of the certificate the package was signed with.",
+			},
+			"certificate_not_before": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The start of the signing certificate's validity period, in RFC3339 format.",
+			},
+			"certificate_not_after": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The end of the signing certificate's validity period, in RFC3339 format.",
+			},
+			"certificate_trusted": {
+				Type:        schema.TypeBool,
+				Computed:    true,
+				Description: "Whether the package signature verified and its certificate chains to a trusted CA.",
+			},
+			"upload_parallelism": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				Description:  "The number of files to upload at once. Defaults to the provider's upload_parallelism. A remote OVA, or one with a checksum, is read in a single pass, so its files are always uploaded one at a time. Only used while importing, so changing it leaves an existing template alone.",
+				ValidateFunc: validation.IntAtLeast(1),
+				// Nothing can be done with a new value until the next import,
+				// which diffs against an empty state.
+				DiffSuppressFunc: func(k, old, new string, d *schema.ResourceData) bool {
+					return d.Id() != ""
+				},
+			},
+			"annotation": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "The notes on the template. When unset, the template keeps the annotation in the OVF; removing it clears the notes.",
+			},
+			"custom_attributes": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "Custom attribute values to set on the template, keyed by custom attribute ID. Requires vCenter.",
+			},
+			"tags": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "The IDs of the tags to attach to the template. Tags attached some other way are left alone. Requires vCenter 6.0 or higher.",
+			},
+			"accept_eula": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Description: "Accept the license agreements in the OVF. Importing an OVF that has any fails without it.",
+			},
+			"eula_digest": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Computed:    true,
+				Description: "The digest of the accepted license agreements. Once recorded, a package with a different license fails until this is set to the new digest.",
+			},
+			"mark_as_template": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				Default:     true,
+				Description: "Convert the imported virtual machine into a template once the import completes.",
+			},
+			"uuid": {
+				Type:        schema.TypeString,
+				Computed:    true,
+				Description: "The BIOS UUID of the imported template.",
 			},
 		},
-		// TODO: datastore, folder, resource pool
 	}
 }
 
 func resourceTemplateCreate(d *schema.ResourceData, m interface{}) error {
-	client := m.(*govmomi.Client)
+	client, err := m.(*ProviderMeta).Client()
+	if err != nil {
+		return err
+	}
 
-	name := d.Get("name").(string)
-	d.SetId(name)
+	// Stopping the provider or running out of time cancels everything from
+	// fetching the package to the import, which aborts the lease.
+	ctx, cancel := context.WithTimeout(m.(*ProviderMeta).StopContext, d.Timeout(schema.TimeoutCreate))
+	defer cancel()
 
-	path := d.Get("path").(string)
+	var checksum *helper.Checksum
+	if v, ok := d.GetOk("checksum"); ok {
+		var err error
+		if checksum, err = helper.ParseChecksum(v.(string)); err != nil {
+			return err
+		}
+	}
 
-	// TODO: find datastore, folder, and resource pool
-	poolID := d.Get("resource_pool_id").(string)
-	poolObj, err := helper.FromID(client, "ResourcePool", poolID)
+	pkg, err := helper.OpenPackage(ctx, d.Get("path").(string), checksum)
 	if err != nil {
 		return err
 	}
-	pool := poolObj.(*object.ResourcePool)
 
-	datastoreID := d.Get("datastore_id").(string)
-	datastoreObj, err := helper.FromID(client, "Datastore", datastoreID)
+	if err := resourceTemplateCheckSignature(d, pkg); err != nil {
+		return err
+	}
+
+	eulaDigest, err := helper.CheckEULA(pkg.Envelope, d.Get("accept_eula").(bool), d.Get("eula_digest").(string))
 	if err != nil {
 		return err
 	}
-	datastore := datastoreObj.(*object.Datastore)
 
 	datacenter := d.Get("datacenter").(string)
 	dc, err := helper.Datacenter(client, datacenter)
@@ -82,31 +263,883 @@ func resourceTemplateCreate(d *schema.ResourceData, m interface{}) error {
 		return fmt.Errorf("Get datacenter: %s", err)
 	}
 
+	pool, host, err := resourceTemplateResourcePool(client, dc, d)
+	if err != nil {
+		return fmt.Errorf("Find resource pool: %s", err)
+	}
+
 	folder, err := helper.FromAbsolutePath(client, d.Get("folder").(string))
 	if err != nil {
 		return err
 	}
 
-	urls, err := helper.Import(context.Background(), path, client, pool, datastore, dc, folder)
+	var datastore *object.Datastore
+	if podID := d.Get("datastore_cluster_id").(string); podID != "" {
+		datastore, err = helper.RecommendCreateDatastore(client, podID, d.Get("name").(string), pool, folder)
+	} else {
+		datastore, err = resourceTemplateDatastore(client, dc, d)
+	}
+	if err != nil {
+		return fmt.Errorf("Find datastore: %s", err)
+	}
+
+	opts := helper.ImportOptions{
+		Name:            d.Get("name").(string),
+		Annotation:      d.Get("annotation").(string),
+		SourceChecksum:  d.Get("checksum").(string),
+		MarkAsTemplate:  d.Get("mark_as_template").(bool),
+		Host:            host,
+		NetworkMappings: map[string]string{},
+		DefaultNetwork:  d.Get("default_network").(string),
+	}
+	for src, dst := range d.Get("network_mappings").(map[string]interface{}) {
+		opts.NetworkMappings[src] = dst.(string)
+	}
+	opts.Properties = expandStringMap(d.Get("properties").(map[string]interface{}))
+
+	opts.Parallelism = m.(*ProviderMeta).UploadParallelism
+	if v, ok := d.GetOk("upload_parallelism"); ok {
+		opts.Parallelism = v.(int)
+	}
+
+	opts.DiskProvisioning = d.Get("disk_provisioning").(string)
+	opts.StorageProfileID = d.Get("storage_policy_id").(string)
+
+	opts.DeploymentOption = d.Get("deployment_option").(string)
+	if opts.DeploymentOption == "" {
+		opts.DeploymentOption = helper.DefaultDeploymentOption(pkg.Envelope)
+	}
+	d.Set("deployment_option", opts.DeploymentOption)
+	d.Set("eula_digest", eulaDigest)
+
+	vm, err := helper.Import(ctx, pkg, client, pool, datastore, dc, folder, opts)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("urls: %+v\n\n", urls)
+	d.SetId(vm.Reference().Value)
 
-	// vm := object.NewVirtualMachine(m.(*vim25.Client), *moref)
+	if err := resourceTemplateApplyTagsAndAttributes(d, m.(*ProviderMeta), vm); err != nil {
+		return err
+	}
 
 	return resourceTemplateRead(d, m)
 }
 
+// resourceTemplateApplyTagsAndAttributes brings the template's custom
+// attributes and tags in line with the configuration.
+func resourceTemplateApplyTagsAndAttributes(d *schema.ResourceData, meta *ProviderMeta, vm *object.VirtualMachine) error {
+	if d.HasChange("custom_attributes") {
+		client, err := meta.Client()
+		if err != nil {
+			return err
+		}
+		old, new := d.GetChange("custom_attributes")
+		if err := helper.ApplyCustomAttributes(client, vm, expandStringMap(old.(map[string]interface{})), expandStringMap(new.(map[string]interface{}))); err != nil {
+			return fmt.Errorf("Set custom attributes: %s", err)
+		}
+	}
+
+	if d.HasChange("tags") {
+		tagsClient, err := meta.TagsClient()
+		if err != nil {
+			return err
+		}
+		if tagsClient == nil {
+			return fmt.Errorf("Set tags: tags require vCenter 6.0 or higher")
+		}
+		old, new := d.GetChange("tags")
+		if err := helper.ApplyTags(tagsClient, vm, expandStringSet(old.(*schema.Set)), expandStringSet(new.(*schema.Set))); err != nil {
+			return fmt.Errorf("Set tags: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// resourceGetter is the part of schema.ResourceData and schema.ResourceDiff
+// that the placement lookups need, so they can run at plan and apply time.
+type resourceGetter interface {
+	Get(key string) interface{}
+}
+
+// resourceTemplateResourcePool finds the resource pool the template goes in,
+// from whichever of host_system_id, compute_cluster_id and resource_pool_id
+// is set. The host is only returned for host_system_id.
+func resourceTemplateResourcePool(client *govmomi.Client, dc *object.Datacenter, d resourceGetter) (*object.ResourcePool, *object.HostSystem, error) {
+	if hostID := d.Get("host_system_id").(string); hostID != "" {
+		hostObj, err := helper.FromID(client, "HostSystem", hostID)
+		if err != nil {
+			return nil, nil, err
+		}
+		poolRef, err := helper.HostResourcePool(client, hostObj.Reference())
+		if err != nil {
+			return nil, nil, err
+		}
+		return object.NewResourcePool(client.Client, *poolRef), hostObj.(*object.HostSystem), nil
+	}
+
+	if clusterID := d.Get("compute_cluster_id").(string); clusterID != "" {
+		pool, err := helper.ClusterResourcePool(client, clusterID)
+		return pool, nil, err
+	}
+
+	if v := d.Get("resource_pool_id").(string); v != "" {
+		pool, err := helper.ResourcePoolFromPathOrID(client, dc, v)
+		return pool, nil, err
+	}
+
+	return nil, nil, fmt.Errorf("one of resource_pool_id, host_system_id or compute_cluster_id must be set")
+}
+
+// resourceTemplateDatastore finds the datastore named by datastore_id. Storage
+// DRS placement needs more than the configuration, so callers handle
+// datastore_cluster_id themselves.
+func resourceTemplateDatastore(client *govmomi.Client, dc *object.Datacenter, d resourceGetter) (*object.Datastore, error) {
+	v := d.Get("datastore_id").(string)
+	if v == "" {
+		return nil, fmt.Errorf("one of datastore_id or datastore_cluster_id must be set")
+	}
+	return helper.DatastoreFromPathOrID(client, dc, v)
+}
+
+// templateDescriptorKeys are the attributes that are checked against the OVF
+// descriptor at plan time.
+var templateDescriptorKeys = []string{
+	"path",
+	"accept_eula",
+	"properties",
+	"deployment_option",
+}
+
+// templateSourceKeys are the attributes that decide what gets imported.
+// vSphere can't change them on an existing template, so changing them
+// replaces it.
+var templateSourceKeys = []string{
+	"path",
+	"datacenter",
+	"checksum",
+	"properties",
+	"deployment_option",
+	"network_mappings",
+	"default_network",
+	"disk_provisioning",
+	"storage_policy_id",
+}
+
+// resourceTemplateCustomizeDiff forces a new template when its source
+// changes, and validates the configuration against the OVF descriptor so
+// that mistakes surface at plan time rather than after an upload has started.
+func resourceTemplateCustomizeDiff(d *schema.ResourceDiff, m interface{}) error {
+	// The source attributes aren't ForceNew in the schema because an imported
+	// template needs to record them in place.
+	if d.Id() != "" && !templateWasImported(d) {
+		for _, key := range templateSourceKeys {
+			if d.HasChange(key) {
+				if err := d.ForceNew(key); err != nil {
+					return err
+				}
+			}
+		}
+
+		// deployment_option holds the old package's default unless it is
+		// set, and a new package has defaults of its own. An option set to
+		// the same value can't be told apart here, but Terraform diffs the
+		// replacement again from the configuration alone, which checks it.
+		if d.HasChange("path") && !d.HasChange("deployment_option") {
+			if err := d.SetNewComputed("deployment_option"); err != nil {
+				return err
+			}
+		}
+	}
+
+	if d.Id() == "" {
+		if err := resourceTemplateCheckPlacementSet(d); err != nil {
+			return err
+		}
+	}
+
+	if err := resourceTemplateCheckMetadataSupported(d, m.(*ProviderMeta)); err != nil {
+		return err
+	}
+
+	// An unknown deployment_option is the package default, so the checks
+	// go ahead with that.
+	changed := d.Id() == ""
+	for _, key := range templateDescriptorKeys {
+		if !d.NewValueKnown(key) && key != "deployment_option" {
+			return nil
+		}
+		changed = changed || d.HasChange(key)
+	}
+	if !changed {
+		return nil
+	}
+
+	// An imported template has nothing to re-import, the apply just records
+	// the source attributes.
+	if templateWasImported(d) {
+		return nil
+	}
+
+	// One deadline covers reading the descriptor and vCenter's checks, and
+	// stopping the provider cancels both.
+	ctx, cancel := context.WithTimeout(m.(*ProviderMeta).StopContext, helper.DefaultAPITimeout)
+	defer cancel()
+	descriptor, envelope, err := helper.ReadEnvelope(ctx, d.Get("path").(string))
+	if err != nil {
+		return fmt.Errorf("Read descriptor: %s", err)
+	}
+
+	eulaDigest, err := helper.CheckEULA(envelope, d.Get("accept_eula").(bool), d.Get("eula_digest").(string))
+	if err != nil {
+		return err
+	}
+	if d.Get("eula_digest").(string) != eulaDigest {
+		if err := d.SetNew("eula_digest", eulaDigest); err != nil {
+			return err
+		}
+	}
+
+	if err := helper.ValidateProperties(envelope, expandStringMap(d.Get("properties").(map[string]interface{}))); err != nil {
+		return err
+	}
+
+	option := helper.DefaultDeploymentOption(envelope)
+	if d.NewValueKnown("deployment_option") {
+		if err := helper.ValidateDeploymentOption(envelope, d.Get("deployment_option").(string)); err != nil {
+			return err
+		}
+		if v := d.Get("deployment_option").(string); v != "" {
+			option = v
+		}
+	}
+
+	return resourceTemplateValidatePlacement(ctx, d, m.(*ProviderMeta), descriptor, option)
+}
+
+// templatePlacementKeys are the alternative ways of saying where a template
+// goes. At least one of each group must be set.
+var templatePlacementKeys = [][]string{
+	{"resource_pool_id", "host_system_id", "compute_cluster_id"},
+	{"datastore_id", "datastore_cluster_id"},
+}
+
+// resourceTemplateCheckPlacementSet makes sure a new template says where to
+// go, since the schema can only express that the alternatives conflict.
+func resourceTemplateCheckPlacementSet(d *schema.ResourceDiff) error {
+	for _, keys := range templatePlacementKeys {
+		set := false
+		for _, key := range keys {
+			if !d.NewValueKnown(key) || d.Get(key).(string) != "" {
+				set = true
+			}
+		}
+		if !set {
+			return fmt.Errorf("one of %s must be set", strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
+
+// resourceTemplateCheckMetadataSupported rejects tags and custom attributes
+// the endpoint can't hold at plan time. They are applied after the import,
+// so finding out at apply time would leave a tainted template behind, to be
+// imported again and fail the same way on every apply.
+func resourceTemplateCheckMetadataSupported(d *schema.ResourceDiff, meta *ProviderMeta) error {
+	if d.NewValueKnown("tags") && d.Get("tags").(*schema.Set).Len() > 0 {
+		tagsClient, err := meta.TagsClient()
+		if err != nil {
+			return err
+		}
+		if tagsClient == nil {
+			return fmt.Errorf("tags require vCenter 6.0 or higher")
+		}
+	}
+	if d.NewValueKnown("custom_attributes") && len(d.Get("custom_attributes").(map[string]interface{})) > 0 {
+		client, err := meta.Client()
+		if err != nil {
+			return err
+		}
+		if !helper.IsVirtualCenter(client) {
+			return fmt.Errorf("custom_attributes require vCenter")
+		}
+	}
+	return nil
+}
+
+// resourceTemplateValidatePlacement runs vCenter's own checks of the
+// descriptor, for deployment option option, against the target resource pool,
+// once the pool is known.
+func resourceTemplateValidatePlacement(ctx context.Context, d *schema.ResourceDiff, meta *ProviderMeta, descriptor []byte, option string) error {
+	for _, key := range []string{"datacenter", "resource_pool_id", "host_system_id", "compute_cluster_id", "disk_provisioning"} {
+		if !d.NewValueKnown(key) {
+			return nil
+		}
+	}
+
+	client, err := meta.Client()
+	if err != nil {
+		return err
+	}
+
+	dc, err := helper.Datacenter(client, d.Get("datacenter").(string))
+	if err != nil {
+		return fmt.Errorf("Get datacenter: %s", err)
+	}
+
+	pool, host, err := resourceTemplateResourcePool(client, dc, d)
+	if err != nil {
+		return fmt.Errorf("Find resource pool: %s", err)
+	}
+
+	return helper.ValidatePlacement(ctx, client, descriptor, pool, helper.PlacementOptions{
+		DeploymentOption: option,
+		DiskProvisioning: d.Get("disk_provisioning").(string),
+		Host:             host,
+	})
+}
+
+// templateWasImported reports whether the template came in through terraform
+// import and its source attributes haven't been recorded yet. path is
+// required, so it is only ever empty in state after an import.
+func templateWasImported(d *schema.ResourceDiff) bool {
+	old, _ := d.GetChange("path")
+	return d.Id() != "" && old.(string) == ""
+}
+
+// resourceTemplateCheckSignature applies the certificate policy to the
+// package signature and records the signer in state.
+func resourceTemplateCheckSignature(d *schema.ResourceData, pkg *helper.Package) error {
+	var roots *x509.CertPool
+	if bundle := d.Get("certificate_ca_bundle").(string); bundle != "" {
+		var err error
+		if roots, err = helper.LoadCABundle(bundle); err != nil {
+			return fmt.Errorf("Load CA bundle: %s", err)
+		}
+	}
+
+	if err := helper.EnforceCertificatePolicy(pkg.Signature, d.Get("certificate_policy").(string), roots); err != nil {
+		return err
+	}
+
+	if pkg.Signature == nil {
+		d.Set("certificate_subject", "")
+		d.Set("certificate_not_before", "")
+		d.Set("certificate_not_after", "")
+		d.Set("certificate_trusted", false)
+		return nil
+	}
+
+	cert := pkg.Signature.Certificate
+	d.Set("certificate_subject", cert.Subject.String())
+	d.Set("certificate_not_before", cert.NotBefore.Format(time.RFC3339))
+	d.Set("certificate_not_after", cert.NotAfter.Format(time.RFC3339))
+	d.Set("certificate_trusted", pkg.Signature.Trust(roots) == nil)
+	return nil
+}
+
 func resourceTemplateRead(d *schema.ResourceData, m interface{}) error {
+	client, err := m.(*ProviderMeta).Client()
+	if err != nil {
+		return err
+	}
+
+	vm, err := templateFromState(client, d)
+	if err != nil {
+		if helper.IsNotFoundError(err) {
+			log.Printf("[DEBUG] template %q not found, removing from state", d.Id())
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Find template: %s", err)
+	}
+
+	// The MOID can change if the template is re-registered, so keep it in
+	// step with whatever the UUID resolved to.
+	d.SetId(vm.Reference().Value)
+
+	props, err := helper.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("Get template properties: %s", err)
+	}
+
+	d.Set("name", props.Name)
+
+	if props.Config != nil {
+		d.Set("uuid", props.Config.Uuid)
+		d.Set("mark_as_template", props.Config.Template)
+		// Unmanaged notes are whatever the OVF came with, so only track
+		// drift once there is an annotation to keep, or when this apply
+		// just changed it, so a clear that didn't stick shows up.
+		if d.Get("annotation").(string) != "" || d.HasChange("annotation") {
+			d.Set("annotation", props.Config.Annotation)
+		}
+	}
+
+	if helper.IsVirtualCenter(client) {
+		// Only the attributes managed here are tracked; others on the
+		// template belong to someone else.
+		attrs := helper.CustomAttributes(&props.ManagedEntity)
+		managed := map[string]string{}
+		for k := range d.Get("custom_attributes").(map[string]interface{}) {
+			if v, ok := attrs[k]; ok {
+				managed[k] = v
+			}
+		}
+		d.Set("custom_attributes", managed)
+	}
+
+	tagsClient, err := m.(*ProviderMeta).TagsClient()
+	if err != nil {
+		return err
+	}
+	if tagsClient != nil {
+		ids, err := helper.ReadTags(tagsClient, vm)
+		if err != nil {
+			return fmt.Errorf("Read template tags: %s", err)
+		}
+		// Like custom attributes, only the tags managed here are tracked.
+		managed := d.Get("tags").(*schema.Set)
+		var attached []string
+		for _, id := range ids {
+			if managed.Contains(id) {
+				attached = append(attached, id)
+			}
+		}
+		d.Set("tags", attached)
+	}
+
+	if props.Parent != nil {
+		folder, err := helper.FromID(client, "Folder", props.Parent.Value)
+		if err != nil {
+			return fmt.Errorf("Get template folder: %s", err)
+		}
+		d.Set("folder", helper.NormalizePath(folder.(*object.Folder).InventoryPath))
+	}
+
+	if len(props.Datastore) > 0 {
+		if podID := d.Get("datastore_cluster_id").(string); podID != "" {
+			// Storage DRS may move the template around the cluster, so only
+			// leaving the cluster counts as drift.
+			actual, err := helper.DatastoreCluster(client, props.Datastore[0])
+			if err != nil {
+				return fmt.Errorf("Get template datastore cluster: %s", err)
+			}
+			d.Set("datastore_cluster_id", actual)
+		} else {
+			d.Set("datastore_id", resourceTemplatePathOrID(client, d, "datastore_id", props.Datastore[0].Value))
+		}
+	}
+
+	if d.Get("host_system_id").(string) != "" && props.Runtime.Host != nil {
+		d.Set("host_system_id", props.Runtime.Host.Value)
+	}
+
+	// Templates have no resource pool, so only refresh it when one is set.
+	// Pools chosen through a host or cluster aren't recorded.
+	if props.ResourcePool != nil && d.Get("resource_pool_id").(string) != "" {
+		d.Set("resource_pool_id", resourceTemplatePathOrID(client, d, "resource_pool_id", props.ResourcePool.Value))
+	}
+
 	return nil
 }
 
+// resourceTemplatePathOrID returns what to record for key, given the ID of the
+// object vSphere reports. An inventory path in the configuration is kept as
+// long as it still leads to that object.
+func resourceTemplatePathOrID(client *govmomi.Client, d *schema.ResourceData, key, id string) string {
+	v := d.Get(key).(string)
+	if v == "" || v == id {
+		return id
+	}
+
+	dc, err := helper.Datacenter(client, d.Get("datacenter").(string))
+	if err != nil {
+		log.Printf("[DEBUG] could not resolve %s %q, recording %s: %s", key, v, id, err)
+		return id
+	}
+
+	var ref object.Reference
+	switch key {
+	case "datastore_id":
+		ref, err = helper.DatastoreFromPathOrID(client, dc, v)
+	case "resource_pool_id":
+		ref, err = helper.ResourcePoolFromPathOrID(client, dc, v)
+	}
+	if err != nil || ref == nil || ref.Reference().Value != id {
+		return id
+	}
+	return v
+}
+
 func resourceTemplateUpdate(d *schema.ResourceData, m interface{}) error {
+	client, err := m.(*ProviderMeta).Client()
+	if err != nil {
+		return err
+	}
+
+	// One deadline covers every task the update runs.
+	ctx, cancel := context.WithTimeout(m.(*ProviderMeta).StopContext, d.Timeout(schema.TimeoutUpdate))
+	defer cancel()
+
+	vm, err := templateFromState(client, d)
+	if err != nil {
+		return fmt.Errorf("Find template: %s", err)
+	}
+
+	if d.HasChange("certificate_policy") || d.HasChange("certificate_ca_bundle") || d.HasChange("accept_eula") || d.HasChange("eula_digest") {
+		if err := resourceTemplateRecheckPackage(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("name") {
+		if err := helper.Rename(ctx, vm, d.Get("name").(string)); err != nil {
+			return fmt.Errorf("Rename template: %s", err)
+		}
+	}
+
+	if d.HasChange("folder") {
+		folder, err := helper.FromAbsolutePath(client, d.Get("folder").(string))
+		if err != nil {
+			return fmt.Errorf("Get template folder: %s", err)
+		}
+		if err := helper.MoveToFolder(ctx, vm, folder); err != nil {
+			return fmt.Errorf("Move template: %s", err)
+		}
+	}
+
+	// Templates can't be placed in a resource pool, so a template becoming a
+	// virtual machine is converted before relocating, and a virtual machine
+	// becoming a template is converted after.
+	toVirtualMachine := d.HasChange("mark_as_template") && !d.Get("mark_as_template").(bool)
+	if toVirtualMachine {
+		if err := resourceTemplateUpdateTemplateState(ctx, client, d, vm); err != nil {
+			return fmt.Errorf("Change template state: %s", err)
+		}
+	}
+
+	if d.HasChange("datastore_id") || d.HasChange("datastore_cluster_id") ||
+		d.HasChange("resource_pool_id") || d.HasChange("host_system_id") || d.HasChange("compute_cluster_id") {
+		if err := resourceTemplateRelocate(ctx, client, d, vm); err != nil {
+			return fmt.Errorf("Relocate template: %s", err)
+		}
+	}
+
+	if d.HasChange("annotation") {
+		if err := helper.SetAnnotation(ctx, vm, d.Get("annotation").(string)); err != nil {
+			return fmt.Errorf("Set template annotation: %s", err)
+		}
+	}
+
+	if err := resourceTemplateApplyTagsAndAttributes(d, m.(*ProviderMeta), vm); err != nil {
+		return err
+	}
+
+	if d.HasChange("mark_as_template") && !toVirtualMachine {
+		if err := resourceTemplateUpdateTemplateState(ctx, client, d, vm); err != nil {
+			return fmt.Errorf("Change template state: %s", err)
+		}
+	}
+
+	return resourceTemplateRead(d, m)
+}
+
+// resourceTemplateRecheckPackage checks the package the template was imported
+// from against changed signature and license settings, which otherwise only
+// apply while importing.
+func resourceTemplateRecheckPackage(ctx context.Context, d *schema.ResourceData) error {
+	pkg, err := helper.OpenPackage(ctx, d.Get("path").(string), nil)
+	if err != nil {
+		return err
+	}
+
+	if err := resourceTemplateCheckSignature(d, pkg); err != nil {
+		return err
+	}
+
+	eulaDigest, err := helper.CheckEULA(pkg.Envelope, d.Get("accept_eula").(bool), d.Get("eula_digest").(string))
+	if err != nil {
+		return err
+	}
+	d.Set("eula_digest", eulaDigest)
 	return nil
 }
 
+// resourceTemplateRelocate migrates the template to its configured datastore
+// and resource pool. Templates don't belong to a pool, so moving one to a new
+// pool means moving it to a host that runs the pool.
+func resourceTemplateRelocate(ctx context.Context, client *govmomi.Client, d *schema.ResourceData, vm *object.VirtualMachine) error {
+	props, err := helper.Properties(vm)
+	if err != nil {
+		return err
+	}
+
+	dc, err := helper.Datacenter(client, d.Get("datacenter").(string))
+	if err != nil {
+		return err
+	}
+
+	var spec types.VirtualMachineRelocateSpec
+	if d.HasChange("datastore_id") || d.HasChange("datastore_cluster_id") {
+		spec.Datastore, err = resourceTemplateRelocateDatastore(client, dc, d, vm, props)
+		if err != nil {
+			return err
+		}
+	}
+	if d.HasChange("resource_pool_id") || d.HasChange("host_system_id") || d.HasChange("compute_cluster_id") {
+		spec.Pool, spec.Host, err = resourceTemplateRelocateCompute(client, dc, d, props)
+		if err != nil {
+			return err
+		}
+	}
+	if spec.Datastore == nil && spec.Pool == nil && spec.Host == nil {
+		return nil
+	}
+
+	return helper.Relocate(ctx, vm, spec)
+}
+
+// resourceTemplateRelocateDatastore returns the datastore to move the template
+// to, or nil if it is already in the configured datastore or datastore
+// cluster.
+func resourceTemplateRelocateDatastore(client *govmomi.Client, dc *object.Datacenter, d *schema.ResourceData, vm *object.VirtualMachine, props *mo.VirtualMachine) (*types.ManagedObjectReference, error) {
+	if podID := d.Get("datastore_cluster_id").(string); podID != "" {
+		if len(props.Datastore) > 0 {
+			current, err := helper.DatastoreCluster(client, props.Datastore[0])
+			if err != nil {
+				return nil, err
+			}
+			if current == podID {
+				return nil, nil
+			}
+		}
+		ds, err := helper.RecommendRelocateDatastore(client, podID, vm)
+		if err != nil {
+			return nil, err
+		}
+		ref := ds.Reference()
+		return &ref, nil
+	}
+
+	ds, err := resourceTemplateDatastore(client, dc, d)
+	if err != nil {
+		return nil, err
+	}
+	ref := ds.Reference()
+	if len(props.Datastore) > 0 && props.Datastore[0] == ref {
+		return nil, nil
+	}
+	return &ref, nil
+}
+
+// resourceTemplateRelocateCompute returns the pool and host to move the
+// template to. Both are nil if it is already where the configuration puts it,
+// as it is when the placement is first set after an import or only switches
+// between a path and an ID.
+func resourceTemplateRelocateCompute(client *govmomi.Client, dc *object.Datacenter, d *schema.ResourceData, props *mo.VirtualMachine) (*types.ManagedObjectReference, *types.ManagedObjectReference, error) {
+	pool, host, err := resourceTemplateResourcePool(client, dc, d)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	placed, err := resourceTemplateComputePlaced(client, d, props, pool)
+	if err != nil || placed {
+		return nil, nil, err
+	}
+
+	var poolRef, hostRef *types.ManagedObjectReference
+	if props.ResourcePool != nil {
+		ref := pool.Reference()
+		poolRef = &ref
+	}
+	if host != nil {
+		ref := host.Reference()
+		hostRef = &ref
+	} else if props.ResourcePool == nil {
+		// Templates aren't in a pool, so they only move to a new one by
+		// moving to a host that runs it.
+		ref, err := helper.ResourcePoolHost(client, pool.Reference())
+		if err != nil {
+			return nil, nil, err
+		}
+		hostRef = &ref
+	}
+	return poolRef, hostRef, nil
+}
+
+// resourceTemplateComputePlaced reports whether the template already runs on
+// the configured host, in the configured cluster or in pool. A template has no
+// pool of its own, so it counts as being in pool when its host runs pool.
+func resourceTemplateComputePlaced(client *govmomi.Client, d *schema.ResourceData, props *mo.VirtualMachine, pool *object.ResourcePool) (bool, error) {
+	if hostID := d.Get("host_system_id").(string); hostID != "" {
+		return props.Runtime.Host != nil && props.Runtime.Host.Value == hostID, nil
+	}
+	if props.ResourcePool != nil && d.Get("compute_cluster_id").(string) == "" {
+		return *props.ResourcePool == pool.Reference(), nil
+	}
+	if props.Runtime.Host == nil {
+		return false, nil
+	}
+
+	cr, err := helper.HostComputeResource(client, *props.Runtime.Host)
+	if err != nil {
+		return false, err
+	}
+	if clusterID := d.Get("compute_cluster_id").(string); clusterID != "" {
+		return cr.Value == clusterID, nil
+	}
+	owner, err := helper.ResourcePoolOwner(client, pool.Reference())
+	if err != nil {
+		return false, err
+	}
+	return owner == cr, nil
+}
+
+// resourceTemplateUpdateTemplateState converts between a template and a plain
+// virtual machine to match mark_as_template.
+func resourceTemplateUpdateTemplateState(ctx context.Context, client *govmomi.Client, d *schema.ResourceData, vm *object.VirtualMachine) error {
+	if d.Get("mark_as_template").(bool) {
+		return helper.MarkAsTemplate(ctx, vm)
+	}
+
+	dc, err := helper.Datacenter(client, d.Get("datacenter").(string))
+	if err != nil {
+		return err
+	}
+	pool, host, err := resourceTemplateResourcePool(client, dc, d)
+	if err != nil {
+		return err
+	}
+	return helper.MarkAsVirtualMachine(ctx, vm, pool, host)
+}
+
 func resourceTemplateDelete(d *schema.ResourceData, m interface{}) error {
+	client, err := m.(*ProviderMeta).Client()
+	if err != nil {
+		return err
+	}
+
+	vm, err := templateFromState(client, d)
+	if err != nil {
+		if helper.IsNotFoundError(err) {
+			d.SetId("")
+			return nil
+		}
+		return fmt.Errorf("Find template: %s", err)
+	}
+
+	props, err := helper.Properties(vm)
+	if err != nil {
+		return fmt.Errorf("Get template properties: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(m.(*ProviderMeta).StopContext, d.Timeout(schema.TimeoutDelete))
+	defer cancel()
+
+	if props.Runtime.PowerState != types.VirtualMachinePowerStatePoweredOff {
+		if err := helper.PowerOff(ctx, vm); err != nil {
+			return fmt.Errorf("Power off template: %s", err)
+		}
+	}
+
+	if err := helper.Destroy(ctx, vm); err != nil {
+		return fmt.Errorf("Destroy template: %s", err)
+	}
+
+	d.SetId("")
 	return nil
 }
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}$`)
+
+// resourceTemplateImport adopts an existing template, given its inventory path
+// or BIOS UUID. Read fills in the rest; the source the template was imported
+// from can't be recovered, so path and friends stay empty until the next
+// apply records them.
+func resourceTemplateImport(d *schema.ResourceData, m interface{}) ([]*schema.ResourceData, error) {
+	client, err := m.(*ProviderMeta).Client()
+	if err != nil {
+		return nil, err
+	}
+
+	var vm *object.VirtualMachine
+	if uuidRegexp.MatchString(d.Id()) {
+		vm, err = helper.FromUUID(client, d.Id())
+	} else {
+		vm, err = helper.FromPath(client, d.Id())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Find template: %s", err)
+	}
+
+	props, err := helper.Properties(vm)
+	if err != nil {
+		return nil, fmt.Errorf("Get template properties: %s", err)
+	}
+
+	dc, err := helper.ParentDatacenter(client, vm)
+	if err != nil {
+		return nil, fmt.Errorf("Find template datacenter: %s", err)
+	}
+
+	// Templates have no resource pool, so use the root pool of the host they
+	// are registered on, which is where they would run if converted.
+	pool := props.ResourcePool
+	if pool == nil && props.Runtime.Host != nil {
+		if pool, err = helper.HostResourcePool(client, *props.Runtime.Host); err != nil {
+			return nil, fmt.Errorf("Find template resource pool: %s", err)
+		}
+	}
+
+	d.SetId(vm.Reference().Value)
+	d.Set("datacenter", helper.NormalizePath(dc.InventoryPath))
+	if pool != nil {
+		d.Set("resource_pool_id", pool.Value)
+	}
+	if props.Config != nil {
+		d.Set("uuid", props.Config.Uuid)
+	}
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// templateFromState finds the template by the MOID held in the resource ID.
+// The MOID changes if the template is re-registered, so when it no longer
+// exists the recorded UUID is used to recover it.
+func templateFromState(client *govmomi.Client, d *schema.ResourceData) (*object.VirtualMachine, error) {
+	vm, err := helper.FromMOID(client, d.Id())
+	if err == nil || !helper.IsManagedObjectNotFoundError(err) {
+		return vm, err
+	}
+	uuid := d.Get("uuid").(string)
+	if uuid == "" {
+		return nil, err
+	}
+	log.Printf("[DEBUG] template %q not found, looking it up by UUID %q", d.Id(), uuid)
+	return helper.FromUUID(client, uuid)
+}
+
+func expandStringMap(raw map[string]interface{}) map[string]string {
+	properties := map[string]string{}
+	for key, value := range raw {
+		properties[key] = value.(string)
+	}
+	return properties
+}
+
+func expandStringSet(set *schema.Set) []string {
+	var values []string
+	for _, v := range set.List() {
+		values = append(values, v.(string))
+	}
+	return values
+}
+
+func validateChecksum(v interface{}, k string) ([]string, []error) {
+	if _, err := helper.ParseChecksum(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
@@ -2,23 +2,33 @@ package main_test
 
 import (
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
 	"regexp"
+	"strings"
 	"testing"
 
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/resource"
 	"github.com/hashicorp/terraform/terraform"
+	"github.com/rowanjacobs/ova-provider-spike/internal/helper"
+	"github.com/vmware/govmomi/vim25/types"
 )
 
 func TestAccResourceTemplate_basic(t *testing.T) {
 	resource.Test(t, resource.TestCase{
 		PreCheck: func() {
 			testAccPreCheck(t)
+			testAccResourceTemplatePreCheck(t)
 		},
 		CheckDestroy: testAccResourceVSphereTemplateCheckExists(false),
 		Providers:    testAccProviders,
 		Steps: []resource.TestStep{
 			{
-				Config: testAccResourceTemplateConfigBasic,
+				Config: testAccResourceTemplateConfigBasic(),
 				Check: resource.ComposeTestCheckFunc(
 					testAccResourceVSphereTemplateCheckExists(true),
 				),
@@ -27,6 +37,87 @@ func TestAccResourceTemplate_basic(t *testing.T) {
 	})
 }
 
+func TestAccResourceTemplate_import(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck: func() {
+			testAccPreCheck(t)
+			testAccResourceTemplatePreCheck(t)
+		},
+		CheckDestroy: testAccResourceVSphereTemplateCheckExists(false),
+		Providers:    testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceTemplateConfigBasic(),
+				Check: resource.ComposeTestCheckFunc(
+					testAccResourceVSphereTemplateCheckExists(true),
+				),
+			},
+			{
+				ResourceName: "ova_template.terraform-test-ovf",
+				ImportState:  true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					attributes, err := testGetAttributesForResource(s, "ova_template.terraform-test-ovf")
+					if err != nil {
+						return "", err
+					}
+					return attributes["uuid"], nil
+				},
+				ImportStateVerify: true,
+				// The source of an imported template can't be recovered, and
+				// templates aren't in a resource pool, so the importer records
+				// the root pool of their host instead of the configured one.
+				// TestAccResourceTemplate_samePlacement checks that setting the
+				// pool again afterwards doesn't move the template.
+				ImportStateVerifyIgnore: []string{
+					"path",
+					"checksum",
+					"deployment_option",
+					"certificate_policy",
+					"certificate_subject",
+					"certificate_not_before",
+					"certificate_not_after",
+					"certificate_trusted",
+					"accept_eula",
+					"eula_digest",
+					"resource_pool_id",
+				},
+			},
+		},
+	})
+}
+
+func TestAccResourceTemplate_samePlacement(t *testing.T) {
+	var placement types.VirtualMachineRelocateSpec
+	resource.Test(t, resource.TestCase{
+		PreCheck: func() {
+			testAccPreCheck(t)
+			testAccResourceTemplatePreCheck(t)
+		},
+		CheckDestroy: testAccResourceVSphereTemplateCheckExists(false),
+		Providers:    testAccProviders,
+		Steps: []resource.TestStep{
+			{
+				Config: testAccResourceTemplateConfigBasic(),
+				Check: resource.ComposeTestCheckFunc(
+					testAccResourceVSphereTemplateCheckExists(true),
+					testAccResourceTemplateGetPlacement(&placement),
+				),
+			},
+			{
+				// Naming the same pool and datastore by path must not move the
+				// template to another host in the pool.
+				SkipFunc: func() (bool, error) {
+					return os.Getenv("VSPHERE_RESOURCE_POOL") == "" || os.Getenv("VSPHERE_DATASTORE") == "", nil
+				},
+				Config: testAccResourceTemplateConfig(os.Getenv("VSPHERE_RESOURCE_POOL"), os.Getenv("VSPHERE_DATASTORE")),
+				Check: resource.ComposeTestCheckFunc(
+					testAccResourceTemplateCheckPlacement(&placement),
+				),
+			},
+		},
+	})
+}
+
 func testAccResourceVSphereTemplateCheckExists(expected bool) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		_, err := testGetTemplate(s, "terraform-test-ovf")
@@ -44,9 +135,185 @@ func testAccResourceVSphereTemplateCheckExists(expected bool) resource.TestCheck
 	}
 }
 
-const testAccResourceTemplateConfigBasic = `
+// testAccResourceTemplateGetPlacement records the host and datastore the
+// template is on.
+func testAccResourceTemplateGetPlacement(placement *types.VirtualMachineRelocateSpec) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		vm, err := testGetTemplate(s, "terraform-test-ovf")
+		if err != nil {
+			return err
+		}
+		props, err := helper.Properties(vm)
+		if err != nil {
+			return err
+		}
+		placement.Host = props.Runtime.Host
+		if len(props.Datastore) > 0 {
+			placement.Datastore = &props.Datastore[0]
+		}
+		return nil
+	}
+}
+
+// testAccResourceTemplateCheckPlacement checks that the template is still on
+// the host and datastore testAccResourceTemplateGetPlacement recorded.
+func testAccResourceTemplateCheckPlacement(placement *types.VirtualMachineRelocateSpec) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		var actual types.VirtualMachineRelocateSpec
+		if err := testAccResourceTemplateGetPlacement(&actual)(s); err != nil {
+			return err
+		}
+		if !reflect.DeepEqual(actual.Host, placement.Host) {
+			return fmt.Errorf("expected template on host %v, got %v", placement.Host, actual.Host)
+		}
+		if !reflect.DeepEqual(actual.Datastore, placement.Datastore) {
+			return fmt.Errorf("expected template on datastore %v, got %v", placement.Datastore, actual.Datastore)
+		}
+		return nil
+	}
+}
+
+// testAccResourceTemplateEnv lists the environment variables that say what
+// to import and where.
+var testAccResourceTemplateEnv = []string{
+	"OVA_TEST_PATH",
+	"VSPHERE_DATACENTER",
+	"VSPHERE_FOLDER",
+	"VSPHERE_RESOURCE_POOL_ID",
+	"VSPHERE_DATASTORE_ID",
+}
+
+func testAccResourceTemplatePreCheck(t *testing.T) {
+	for _, key := range testAccResourceTemplateEnv {
+		if os.Getenv(key) == "" {
+			t.Fatalf("%s must be set for ova_template acceptance tests", key)
+		}
+	}
+}
+
+func testAccResourceTemplateConfigBasic() string {
+	return testAccResourceTemplateConfig(os.Getenv("VSPHERE_RESOURCE_POOL_ID"), os.Getenv("VSPHERE_DATASTORE_ID"))
+}
+
+// testAccResourceTemplateConfig imports the test OVA into pool and datastore,
+// each given by ID or by path.
+func testAccResourceTemplateConfig(pool, datastore string) string {
+	return fmt.Sprintf(`
 resource "ova_template" "terraform-test-ovf" {
-	name = "some-template"
-	path = "some-ovf-path"
+	name             = "terraform-test-ovf"
+	path             = "%s"
+	datacenter       = "%s"
+	folder           = "%s"
+	resource_pool_id = "%s"
+	datastore_id     = "%s"
+	accept_eula      = true
+}
+`,
+		os.Getenv("OVA_TEST_PATH"),
+		os.Getenv("VSPHERE_DATACENTER"),
+		os.Getenv("VSPHERE_FOLDER"),
+		pool,
+		datastore,
+	)
+}
+
+const testSizedDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <DeploymentOptionSection>
+    <Info>Sizes</Info>
+    <Configuration ovf:id="small">
+      <Label>Small</Label>
+      <Description>2 vCPU</Description>
+    </Configuration>
+    <Configuration ovf:id="medium" ovf:default="true">
+      <Label>Medium</Label>
+      <Description>4 vCPU</Description>
+    </Configuration>
+  </DeploymentOptionSection>
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+  </VirtualSystem>
+</Envelope>`
+
+const testUnsizedDescriptor = `<?xml version="1.0" encoding="UTF-8"?>
+<Envelope xmlns="http://schemas.dmtf.org/ovf/envelope/1" xmlns:ovf="http://schemas.dmtf.org/ovf/envelope/1">
+  <VirtualSystem ovf:id="appliance">
+    <Info>A virtual machine</Info>
+  </VirtualSystem>
+</Envelope>`
+
+// TestResourceTemplateDiff_pathChangeDeploymentOption moves a template whose
+// deployment_option was left to the package default to a package without
+// deployment options. Placement is left unknown so no vSphere is needed.
+func TestResourceTemplateDiff_pathChangeDeploymentOption(t *testing.T) {
+	defer testUnsetVSphereEnv()()
+
+	dir, err := ioutil.TempDir("", "ova")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	oldPath := filepath.Join(dir, "sized.ovf")
+	newPath := filepath.Join(dir, "unsized.ovf")
+	for p, descriptor := range map[string]string{oldPath: testSizedDescriptor, newPath: testUnsizedDescriptor} {
+		if err := ioutil.WriteFile(p, []byte(descriptor), 0644); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+
+	provider := testUnconfiguredProvider(t)
+	r := provider.ResourcesMap["ova_template"]
+	state := &terraform.InstanceState{
+		ID: "vm-1",
+		Attributes: map[string]string{
+			"id":                "vm-1",
+			"name":              "appliance",
+			"path":              oldPath,
+			"datacenter":        "dc1",
+			"resource_pool_id":  "resgroup-1",
+			"datastore_id":      "datastore-1",
+			"deployment_option": "medium",
+			"mark_as_template":  "true",
+		},
+	}
+
+	for _, tc := range []struct {
+		option string
+		fails  bool
+	}{
+		{"", false},
+		{"medium", true},
+	} {
+		attrs := map[string]interface{}{
+			"name":             "appliance",
+			"path":             newPath,
+			"datacenter":       config.UnknownVariableValue,
+			"resource_pool_id": config.UnknownVariableValue,
+			"datastore_id":     config.UnknownVariableValue,
+		}
+		if tc.option != "" {
+			attrs["deployment_option"] = tc.option
+		}
+		raw, err := config.NewRawConfig(attrs)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+
+		diff, err := r.Diff(state, terraform.NewResourceConfig(raw), provider.Meta())
+		if tc.fails {
+			if err == nil || !strings.Contains(err.Error(), "declares no deployment options") {
+				t.Fatalf("option %q: expected the option to be rejected, got %v", tc.option, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("option %q: err: %s", tc.option, err)
+		}
+		if !diff.RequiresNew() {
+			t.Fatalf("option %q: expected the template to be replaced", tc.option)
+		}
+		if attr := diff.Attributes["deployment_option"]; attr == nil || !attr.NewComputed {
+			t.Fatalf("option %q: expected deployment_option to be recomputed, got %#v", tc.option, attr)
+		}
+	}
 }
-`